@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/wsw0108/aliyun-fc-releaser/internal/logging"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/report"
+)
+
+// ConfirmRelease computes changes of plan with a dry run, and asks for approval of them
+// before the real release.
+func ConfirmRelease(ctx *Context, plan *Plan, in io.Reader, out io.Writer) error {
+	logging.Info("Computing changes for approval")
+	realReport := ctx.report
+	preview := &report.Report{
+		Version:   realReport.Version,
+		Alias:     realReport.Alias,
+		Region:    realReport.Region,
+		StartTime: realReport.StartTime,
+	}
+	ctx.dryRun, ctx.report = true, preview
+	err := runRelease(ctx, plan)
+	ctx.dryRun, ctx.report = false, realReport
+	if err != nil {
+		return fmt.Errorf("compute changes: %w", err)
+	}
+
+	changes := preview.Changes()
+	fmt.Fprintf(out, "\nChanges of release %s (alias %s) in region %s:\n", plan.Version.Raw, plan.AliasName, ctx.regionID)
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "  (none)")
+	}
+	for _, change := range changes {
+		fmt.Fprintf(out, "  %s\n", change)
+	}
+	approved, err := approve(in, out, "Apply these changes?")
+	if err != nil {
+		return err
+	}
+	if !approved {
+		return fmt.Errorf("release not approved, use -yes to approve without confirmation")
+	}
+	return nil
+}
+
+// approve asks for confirmation of question on in, only "y" or "yes" approves.
+func approve(in io.Reader, out io.Writer, question string) (bool, error) {
+	fmt.Fprintf(out, "%s [y/N]: ", question)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// isTerminal reports whether f is a character device, e.g. an interactive terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wsw0108/aliyun-fc-releaser/internal/cert"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/domaindiff"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/fcapi"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/logging"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/report"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/serverless"
+)
+
+// LoadCertConfig replaces certificate and private key paths in customDomain with PEM contents,
+// and checks expiry of the certificate.
+func LoadCertConfig(ctx *Context, customDomain *serverless.CustomDomain, baseDir string) error {
+	certConfig := &customDomain.CertConfig
+	var err error
+	if certConfig.Certificate, err = cert.Load(certConfig.Certificate, baseDir); err != nil {
+		return err
+	}
+	if certConfig.PrivateKey, err = cert.Load(certConfig.PrivateKey, baseDir); err != nil {
+		return err
+	}
+	if certConfig.Certificate == "" {
+		return nil
+	}
+	expiry, err := cert.Expiry(certConfig.Certificate)
+	if err != nil {
+		return fmt.Errorf("invalid certificate %s of custom domain %s: %w", certConfig.CertName, customDomain.DomainName, err)
+	}
+	left := time.Until(expiry)
+	if left <= 0 {
+		return fmt.Errorf("certificate %s of custom domain %s expired at %s", certConfig.CertName, customDomain.DomainName, expiry.Format(time.RFC3339))
+	}
+	if left < ctx.certExpiryWarning {
+		logging.Warn("Certificate expires soon", "domain", customDomain.DomainName, "cert", certConfig.CertName, "expiry", expiry.Format(time.RFC3339), "days", int(left.Hours()/24))
+	}
+	return nil
+}
+
+func UpdateCustomDomain(ctx *Context, customDomain serverless.CustomDomain, qualifier string) error {
+	lg := logging.With("step", "domain", "domain", customDomain.DomainName, "qualifier", qualifier)
+	current, err := ctx.apiClient.GetCustomDomain(customDomain.DomainName)
+	if err != nil && !fcapi.IsNotFound(err) {
+		return err
+	}
+	if current == nil {
+		lg.Info("Create custom domain")
+		createCustomDomainInput := &fcapi.CustomDomain{
+			DomainName:  customDomain.DomainName,
+			Protocol:    customDomain.Protocol,
+			RouteConfig: &fcapi.RouteConfig{},
+		}
+		for _, route := range customDomain.RouteConfig.Routes {
+			mainQualifier := qualifier
+			if ctx.snapshot {
+				prefixedRoute := newPathConfig(route, "/"+qualifier+route.Path, qualifier)
+				prefixedRoute.RewriteConfig = nil
+				createCustomDomainInput.RouteConfig.Routes = append(createCustomDomainInput.RouteConfig.Routes, prefixedRoute)
+				// NOTE: unprefixed routes of a snapshot release only point to a stable alias
+				baseline, err := ResolveBaselineQualifier(ctx, route.ServiceName)
+				if err != nil {
+					return err
+				}
+				if baseline == "" {
+					lg.Warn("Route not added, no stable alias", "path", route.Path, "service", route.ServiceName)
+					continue
+				}
+				mainQualifier = baseline
+			}
+			newRoute := newPathConfig(route, route.Path, mainQualifier)
+			createCustomDomainInput.RouteConfig.Routes = append(createCustomDomainInput.RouteConfig.Routes, newRoute)
+		}
+		createCustomDomainInput.CertConfig = newCertConfig(customDomain)
+		createCustomDomainInput.TLSConfig = newTLSConfig(customDomain)
+		createCustomDomainInput.WAFConfig = newWAFConfig(customDomain)
+		logRoutes(lg, logging.LevelInfo, "Route to create", createCustomDomainInput.RouteConfig.Routes)
+		ctx.report.UpdateCustomDomain(customDomain.DomainName, func(d *report.CustomDomain) {
+			d.Created = true
+			d.After = reportRoutes(createCustomDomainInput.RouteConfig.Routes)
+		})
+		if !ctx.dryRun {
+			err = ctx.apiClient.CreateCustomDomain(createCustomDomainInput)
+		}
+		return err
+	}
+	desired := &fcapi.CustomDomain{
+		DomainName:  customDomain.DomainName,
+		Protocol:    customDomain.Protocol,
+		RouteConfig: &fcapi.RouteConfig{},
+		CertConfig:  newCertConfig(customDomain),
+		TLSConfig:   newTLSConfig(customDomain),
+		WAFConfig:   newWAFConfig(customDomain),
+	}
+	routeConfig := desired.RouteConfig
+	var currentRoutes []fcapi.PathConfig
+	if current.RouteConfig != nil {
+		currentRoutes = current.RouteConfig.Routes
+	}
+	var mainRoutes []fcapi.PathConfig
+	for _, route := range currentRoutes {
+		// 非ROS，fun deploy直接用template中的覆盖
+		// ROS，fun deploy不改变路由设置
+		for _, froute := range customDomain.RouteConfig.Routes {
+			if route.Path != froute.Path || route.ServiceName != froute.ServiceName || route.FunctionName != froute.FunctionName {
+				continue
+			}
+			if ctx.snapshot {
+				// NOTE: snapshot releases never switch main routes away from a stable alias,
+				// only routes pointing to LATEST or a snapshot alias are moved to the baseline
+				mainQualifier, err := snapshotMainQualifier(ctx, route)
+				if err != nil {
+					return err
+				}
+				route = newPathConfig(froute, route.Path, mainQualifier)
+			} else {
+				route = newPathConfig(froute, route.Path, qualifier)
+			}
+			mainRoutes = append(mainRoutes, route)
+			break
+		}
+		// methods and rewrite config of routes not in template are preserved as is
+		routeConfig.Routes = append(routeConfig.Routes, route)
+	}
+	if ctx.snapshot {
+		logRoutes(lg, logging.LevelInfo, "Main route", mainRoutes)
+	}
+	routeExistsInConfig := func(routeConfig *fcapi.RouteConfig, route *fcapi.PathConfig) bool {
+		for _, r := range routeConfig.Routes {
+			if r.ServiceName == route.ServiceName && r.FunctionName == route.FunctionName && r.Path == route.Path && r.Qualifier == route.Qualifier {
+				return true
+			}
+		}
+		return false
+	}
+	if ctx.snapshot {
+		for _, route := range customDomain.RouteConfig.Routes {
+			prefix := "/" + qualifier
+			newRoute := newPathConfig(route, prefix+route.Path, qualifier)
+			// NOTE: rewrite rules match the unprefixed path, do not apply them to prefixed routes
+			newRoute.RewriteConfig = nil
+			if !routeExistsInConfig(routeConfig, &newRoute) {
+				routeConfig.Routes = append(routeConfig.Routes, newRoute)
+			}
+		}
+	}
+	// NOTE: custom domains have a route quota, keep a fixed number of snapshot prefixes
+	kept, removed, err := PruneSnapshotPrefixes(ctx, routeConfig.Routes, qualifier)
+	if err != nil {
+		return err
+	}
+	if len(removed) > 0 {
+		logRoutes(lg.With("max_prefixes", ctx.maxSnapshotPrefixes), logging.LevelInfo, "Snapshot route to remove", removed)
+		routeConfig.Routes = kept
+	}
+
+	diff := domaindiff.Diff(current, desired)
+	ctx.report.UpdateCustomDomain(customDomain.DomainName, func(d *report.CustomDomain) {
+		d.Before = reportRoutes(currentRoutes)
+		d.After = reportRoutes(routeConfig.Routes)
+		for _, change := range diff.Routes {
+			d.Changes = append(d.Changes, change.String())
+		}
+	})
+	if !diff.Changed() {
+		lg.Info("Custom domain is up to date")
+		return nil
+	}
+	if diff.Protocol {
+		lg.Info("Change protocol", "before", current.Protocol, "after", desired.Protocol)
+	}
+	// NOTE: tls, waf and cert configs are only sent when changed, nil means unchanged
+	updateCustomDomainInput := *desired
+	if diff.Cert {
+		lg.Info("Change certificate", "cert", desired.CertConfig.CertName)
+	} else {
+		updateCustomDomainInput.CertConfig = nil
+	}
+	if diff.TLS {
+		lg.Info("Change tls", "min_version", desired.TLSConfig.MinVersion, "max_version", desired.TLSConfig.MaxVersion, "cipher_suites", desired.TLSConfig.CipherSuites)
+	} else {
+		updateCustomDomainInput.TLSConfig = nil
+	}
+	if diff.WAF {
+		lg.Info("Change waf", "enabled", desired.WAFConfig.EnableWAF)
+	} else {
+		updateCustomDomainInput.WAFConfig = nil
+	}
+	for _, change := range diff.Routes {
+		lg.Info("Change route", "change", change)
+	}
+	lg.Info("Update custom domain")
+	logRoutes(lg, logging.LevelDebug, "Route to update", routeConfig.Routes)
+	if !ctx.dryRun {
+		err = ctx.apiClient.UpdateCustomDomain(&updateCustomDomainInput)
+	}
+	return err
+}
+
+func newCertConfig(customDomain serverless.CustomDomain) *fcapi.CertConfig {
+	if customDomain.CertConfig.Certificate == "" {
+		return nil
+	}
+	return &fcapi.CertConfig{
+		CertName:    customDomain.CertConfig.CertName,
+		Certificate: customDomain.CertConfig.Certificate,
+		PrivateKey:  customDomain.CertConfig.PrivateKey,
+	}
+}
+
+func newTLSConfig(customDomain serverless.CustomDomain) *fcapi.TLSConfig {
+	tlsConfig := customDomain.TLSConfig
+	if tlsConfig.MinVersion == "" && tlsConfig.MaxVersion == "" && len(tlsConfig.CipherSuites) == 0 {
+		return nil
+	}
+	return &fcapi.TLSConfig{
+		MinVersion:   tlsConfig.MinVersion,
+		MaxVersion:   tlsConfig.MaxVersion,
+		CipherSuites: tlsConfig.CipherSuites,
+	}
+}
+
+func newWAFConfig(customDomain serverless.CustomDomain) *fcapi.WAFConfig {
+	if customDomain.WAFConfig == nil {
+		return nil
+	}
+	return &fcapi.WAFConfig{EnableWAF: customDomain.WAFConfig.EnableWAF}
+}
+
+func newPathConfig(route serverless.PathConfig, path string, qualifier string) fcapi.PathConfig {
+	newRoute := fcapi.PathConfig{
+		Path:         path,
+		ServiceName:  route.ServiceName,
+		FunctionName: route.FunctionName,
+		Qualifier:    qualifier,
+		Methods:      route.Methods,
+	}
+	if route.RewriteConfig != nil {
+		newRoute.RewriteConfig = &fcapi.RewriteConfig{}
+		for _, rule := range route.RewriteConfig.EqualRules {
+			newRoute.RewriteConfig.EqualRules = append(newRoute.RewriteConfig.EqualRules, fcapi.RewriteRule(rule))
+		}
+		for _, rule := range route.RewriteConfig.WildcardRules {
+			newRoute.RewriteConfig.WildcardRules = append(newRoute.RewriteConfig.WildcardRules, fcapi.RewriteRule(rule))
+		}
+		for _, rule := range route.RewriteConfig.RegexRules {
+			newRoute.RewriteConfig.RegexRules = append(newRoute.RewriteConfig.RegexRules, fcapi.RewriteRule(rule))
+		}
+	}
+	return newRoute
+}
+
+func reportRoutes(routes []fcapi.PathConfig) []report.Route {
+	var reported []report.Route
+	for _, route := range routes {
+		reported = append(reported, report.Route{
+			Path:         route.Path,
+			ServiceName:  route.ServiceName,
+			FunctionName: route.FunctionName,
+			Qualifier:    route.Qualifier,
+			Methods:      route.Methods,
+		})
+	}
+	return reported
+}
+
+func logRoutes(lg *logging.Logger, level logging.Level, msg string, routes []fcapi.PathConfig) {
+	for _, route := range routes {
+		lg.Log(level, msg, "path", route.Path, "service", route.ServiceName, "function", route.FunctionName, "route_qualifier", route.Qualifier, "methods", route.Methods)
+	}
+}
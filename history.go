@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/user"
+
+	"github.com/wsw0108/aliyun-fc-releaser/internal/history"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/logging"
+)
+
+// History writes release history of services in template in regions of stages to w.
+func History(stages []*Stage, templateData []byte, w io.Writer, format string) error {
+	var entries []history.Entry
+	var failed bool
+	for _, stage := range stages {
+		for _, region := range stage.Regions {
+			ctx, serviceNames, err := templateServices(stage, region, templateData)
+			if err != nil {
+				logging.Error("Read history failed", "stage", stage.Name, "region", region, "error", err)
+				failed = true
+				continue
+			}
+			for _, serviceName := range serviceNames {
+				serviceEntries, err := history.Load(ctx.fcClient, serviceName)
+				if err != nil {
+					logging.Error("Read history failed", "stage", stage.Name, "region", region, "service", serviceName, "error", err)
+					failed = true
+					continue
+				}
+				for _, e := range serviceEntries {
+					e.Region = region
+					entries = append(entries, e)
+				}
+			}
+		}
+	}
+	if err := history.Write(w, format, entries); err != nil {
+		return err
+	}
+	if failed {
+		return errors.New("read history failed")
+	}
+	return nil
+}
+
+// defaultOperator is the user triggered the CI job, or the current user.
+func defaultOperator() string {
+	for _, key := range []string{"GITLAB_USER_LOGIN", "GITHUB_ACTOR", "BUILD_USER_ID"} {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+	return currentUser()
+}
+
+// ciRunURL returns url of the running job of common CI systems, or empty if not in CI.
+func ciRunURL() string {
+	for _, key := range []string{"CI_JOB_URL", "BUILD_URL"} {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+	if id := os.Getenv("GITHUB_RUN_ID"); id != "" {
+		return os.Getenv("GITHUB_SERVER_URL") + "/" + os.Getenv("GITHUB_REPOSITORY") + "/actions/runs/" + id
+	}
+	return ""
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
@@ -0,0 +1,125 @@
+package alias
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/wsw0108/aliyun-fc-releaser/internal/version"
+)
+
+// NOTE: 1.2.3/v1.2.3 -> v1_2_3, prerelease 1.2.3-rc.1 -> v1_2_3-rc_1_2006_01_02
+const DefaultTemplate = "v{{underscore .Version}}{{if .Pre}}_{{.Date}}{{end}}"
+
+// default templates of non-semver versions: 2024.10.18 -> v2024_10_18, build-123 -> build_123
+var DefaultTemplates = map[string]string{
+	version.SchemeSemver: DefaultTemplate,
+	version.SchemeCalver: "v{{underscore .Version}}",
+	version.SchemeBuild:  "build_{{.Major}}",
+}
+
+const DateLayout = "2006_01_02"
+
+// 字母开头，字母数字下划线中划线，长度1-128
+var nameRegex = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9_-]{0,127}$")
+
+type Data struct {
+	Version     string
+	Major       uint64
+	Minor       uint64
+	Patch       uint64
+	Pre         string
+	Build       string
+	Commit      string
+	ShortCommit string
+	Date        string
+	Time        time.Time
+	Timestamp   int64
+}
+
+func NewData(ver version.Version, commit string, now time.Time) Data {
+	d := Data{
+		Version:   ver.Raw,
+		Major:     ver.Major(),
+		Minor:     ver.Minor(),
+		Patch:     ver.Patch(),
+		Pre:       ver.Pre(),
+		Build:     ver.Build(),
+		Commit:    commit,
+		Date:      now.Format(DateLayout),
+		Time:      now,
+		Timestamp: now.Unix(),
+	}
+	d.ShortCommit = commit
+	if len(d.ShortCommit) > 7 {
+		d.ShortCommit = d.ShortCommit[:7]
+	}
+	return d
+}
+
+// Stable returns data of the release without prerelease and build parts,
+// which is used to name the baseline alias of a snapshot release.
+func (d Data) Stable() Data {
+	s := d
+	s.Version = fmt.Sprintf("%d.%d.%d", d.Major, d.Minor, d.Patch)
+	s.Pre = ""
+	s.Build = ""
+	return s
+}
+
+var funcs = template.FuncMap{
+	"underscore": func(s string) string {
+		return strings.ReplaceAll(s, ".", "_")
+	},
+	"replace": func(old, new, s string) string {
+		return strings.ReplaceAll(s, old, new)
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+type Namer struct {
+	tpl *template.Template
+}
+
+func NewNamer(text string) (*Namer, error) {
+	tpl, err := template.New("alias").Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid alias template %q: %w", text, err)
+	}
+	return &Namer{tpl: tpl}, nil
+}
+
+func (n *Namer) Name(data Data) (string, error) {
+	var buf bytes.Buffer
+	if err := n.tpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	name := buf.String()
+	if err := Validate(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func Validate(name string) error {
+	if !nameRegex.MatchString(name) {
+		return fmt.Errorf("invalid alias name %q: must start with a letter, contain only letters, digits, '_' and '-', and be at most 128 characters", name)
+	}
+	return nil
+}
+
+// ParseDate parses date suffix of alias names generated by DefaultTemplate for prereleases.
+func ParseDate(name string) (time.Time, bool) {
+	if len(name) < len(DateLayout) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(DateLayout, name[len(name)-len(DateLayout):])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,50 @@
+package cert
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Load returns PEM content of value, value is either PEM itself or
+// path of a PEM file, relative paths are resolved against baseDir.
+func Load(value string, baseDir string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.HasPrefix(value, "-----BEGIN") {
+		return value, nil
+	}
+	filename := value
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(baseDir, filename)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	if block, _ := pem.Decode(content); block == nil {
+		return "", fmt.Errorf("%s is not a PEM file", filename)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// Expiry returns NotAfter of the leaf (first) certificate in PEM content.
+func Expiry(certificate string) (time.Time, error) {
+	block, _ := pem.Decode([]byte(certificate))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return time.Time{}, fmt.Errorf("no certificate found in PEM")
+	}
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return c.NotAfter, nil
+}
+
+// Equal compares two PEM contents ignoring differences of whitespaces.
+func Equal(a, b string) bool {
+	return strings.Join(strings.Fields(a), "") == strings.Join(strings.Fields(b), "")
+}
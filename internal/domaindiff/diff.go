@@ -0,0 +1,179 @@
+package domaindiff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/wsw0108/aliyun-fc-releaser/internal/cert"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/fcapi"
+)
+
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+type RouteChange struct {
+	Kind   string
+	Path   string
+	Before *fcapi.PathConfig
+	After  *fcapi.PathConfig
+	Fields []string
+}
+
+func (c RouteChange) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s -> %s", c.Path, describeRoute(c.After))
+	case Removed:
+		return fmt.Sprintf("- %s -> %s", c.Path, describeRoute(c.Before))
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s (%s)", c.Path, describeRoute(c.Before), describeRoute(c.After), strings.Join(c.Fields, ", "))
+	}
+}
+
+func describeRoute(r *fcapi.PathConfig) string {
+	return fmt.Sprintf("%s/%s[%s] methods %v", r.ServiceName, r.FunctionName, r.Qualifier, r.Methods)
+}
+
+type Result struct {
+	Protocol bool
+	Cert     bool
+	TLS      bool
+	WAF      bool
+	Routes   []RouteChange
+}
+
+func (r Result) Changed() bool {
+	return r.Protocol || r.Cert || r.TLS || r.WAF || len(r.Routes) > 0
+}
+
+// Diff compares current state of a custom domain with desired one, nil cert, tls and waf configs
+// of desired mean unmanaged and are never reported as changes.
+func Diff(current, desired *fcapi.CustomDomain) Result {
+	var result Result
+	result.Protocol = !strings.EqualFold(current.Protocol, desired.Protocol)
+	if desired.CertConfig != nil {
+		result.Cert = current.CertConfig == nil || current.CertConfig.CertName != desired.CertConfig.CertName || !cert.Equal(current.CertConfig.Certificate, desired.CertConfig.Certificate)
+	}
+	if desired.TLSConfig != nil {
+		result.TLS = !tlsEqual(current.TLSConfig, desired.TLSConfig)
+	}
+	if desired.WAFConfig != nil {
+		result.WAF = current.WAFConfig == nil || current.WAFConfig.EnableWAF != desired.WAFConfig.EnableWAF
+	}
+	result.Routes = Routes(routesOf(current), routesOf(desired))
+	return result
+}
+
+func routesOf(d *fcapi.CustomDomain) []fcapi.PathConfig {
+	if d.RouteConfig == nil {
+		return nil
+	}
+	return d.RouteConfig.Routes
+}
+
+// Routes compares routes by path, which is unique in a custom domain, order of routes is ignored.
+func Routes(before, after []fcapi.PathConfig) []RouteChange {
+	beforeRoutes := make(map[string]fcapi.PathConfig)
+	for _, r := range before {
+		beforeRoutes[r.Path] = r
+	}
+	afterRoutes := make(map[string]fcapi.PathConfig)
+	for _, r := range after {
+		afterRoutes[r.Path] = r
+	}
+	var changes []RouteChange
+	for path, b := range beforeRoutes {
+		b := b
+		a, ok := afterRoutes[path]
+		if !ok {
+			changes = append(changes, RouteChange{Kind: Removed, Path: path, Before: &b})
+			continue
+		}
+		if fields := routeFields(b, a); len(fields) > 0 {
+			a := a
+			changes = append(changes, RouteChange{Kind: Changed, Path: path, Before: &b, After: &a, Fields: fields})
+		}
+	}
+	for path, a := range afterRoutes {
+		a := a
+		if _, ok := beforeRoutes[path]; !ok {
+			changes = append(changes, RouteChange{Kind: Added, Path: path, After: &a})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func routeFields(a, b fcapi.PathConfig) []string {
+	var fields []string
+	if a.ServiceName != b.ServiceName {
+		fields = append(fields, "serviceName")
+	}
+	if a.FunctionName != b.FunctionName {
+		fields = append(fields, "functionName")
+	}
+	if normalizeQualifier(a.Qualifier) != normalizeQualifier(b.Qualifier) {
+		fields = append(fields, "qualifier")
+	}
+	if !reflect.DeepEqual(normalizeMethods(a.Methods), normalizeMethods(b.Methods)) {
+		fields = append(fields, "methods")
+	}
+	if !reflect.DeepEqual(normalizeRewrite(a.RewriteConfig), normalizeRewrite(b.RewriteConfig)) {
+		fields = append(fields, "rewriteConfig")
+	}
+	return fields
+}
+
+func normalizeQualifier(q string) string {
+	if q == "" {
+		return "LATEST"
+	}
+	return q
+}
+
+func normalizeMethods(methods []string) []string {
+	var result []string
+	for _, m := range methods {
+		result = append(result, strings.ToUpper(m))
+	}
+	sort.Strings(result)
+	return result
+}
+
+func normalizeRewrite(c *fcapi.RewriteConfig) *fcapi.RewriteConfig {
+	if c == nil || len(c.EqualRules) == 0 && len(c.WildcardRules) == 0 && len(c.RegexRules) == 0 {
+		return nil
+	}
+	n := &fcapi.RewriteConfig{}
+	if len(c.EqualRules) > 0 {
+		n.EqualRules = c.EqualRules
+	}
+	if len(c.WildcardRules) > 0 {
+		n.WildcardRules = c.WildcardRules
+	}
+	if len(c.RegexRules) > 0 {
+		n.RegexRules = c.RegexRules
+	}
+	return n
+}
+
+func tlsEqual(a, b *fcapi.TLSConfig) bool {
+	if a == nil {
+		a = &fcapi.TLSConfig{}
+	}
+	if b == nil {
+		b = &fcapi.TLSConfig{}
+	}
+	suitesA := append([]string(nil), a.CipherSuites...)
+	suitesB := append([]string(nil), b.CipherSuites...)
+	sort.Strings(suitesA)
+	sort.Strings(suitesB)
+	return a.MinVersion == b.MinVersion && a.MaxVersion == b.MaxVersion && reflect.DeepEqual(suitesA, suitesB)
+}
@@ -0,0 +1,222 @@
+package fakefc
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server is an in-memory stand-in of FC open API for manual tests,
+// resources are stored as JSON objects and list APIs are paginated.
+// Aliases can also be created, updated and deleted.
+type Server struct {
+	*httptest.Server
+
+	PageSize int
+
+	mu               sync.Mutex
+	versions         map[string][]Object
+	aliases          map[string][]Object
+	triggers         map[string][]Object
+	provisionConfigs []Object
+	customDomains    []Object
+}
+
+type Object map[string]interface{}
+
+func New() *Server {
+	s := &Server{
+		PageSize: 2,
+		versions: make(map[string][]Object),
+		aliases:  make(map[string][]Object),
+		triggers: make(map[string][]Object),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *Server) AddVersion(serviceName string, version Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.versions[serviceName] = append(s.versions[serviceName], version)
+}
+
+func (s *Server) AddAlias(serviceName string, alias Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.aliases[serviceName] = append(s.aliases[serviceName], alias)
+}
+
+func (s *Server) AddTrigger(serviceName string, functionName string, trigger Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := serviceName + "/" + functionName
+	s.triggers[key] = append(s.triggers[key], trigger)
+}
+
+func (s *Server) AddProvisionConfig(config Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.provisionConfigs = append(s.provisionConfigs, config)
+}
+
+func (s *Server) AddCustomDomain(domain Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.customDomains = append(s.customDomains, domain)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Header.Get("Authorization") == "" {
+		writeError(w, http.StatusForbidden, "InvalidAccessKeyID", "missing authorization")
+		return
+	}
+	// /<apiVersion>/...
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 {
+		writeError(w, http.StatusNotFound, "NotFound", r.URL.Path)
+		return
+	}
+	parts = parts[1:]
+	if len(parts) == 4 && parts[0] == "services" && parts[2] == "aliases" {
+		s.handleAlias(w, r, parts[1], parts[3])
+		return
+	}
+	if len(parts) == 3 && parts[0] == "services" && parts[2] == "aliases" && r.Method == http.MethodPost {
+		s.createAlias(w, r, parts[1])
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+		return
+	}
+	switch {
+	case len(parts) == 3 && parts[0] == "services" && parts[2] == "versions":
+		s.writePage(w, r, "versions", s.versions[parts[1]])
+	case len(parts) == 3 && parts[0] == "services" && parts[2] == "aliases":
+		s.writePage(w, r, "aliases", s.aliases[parts[1]])
+	case len(parts) == 5 && parts[0] == "services" && parts[2] == "functions" && parts[4] == "triggers":
+		s.writePage(w, r, "triggers", s.triggers[parts[1]+"/"+parts[3]])
+	case len(parts) == 1 && parts[0] == "provision-configs":
+		s.writePage(w, r, "provisionConfigs", s.provisionConfigs)
+	case len(parts) == 1 && parts[0] == "custom-domains":
+		s.writePage(w, r, "customDomains", s.customDomains)
+	default:
+		writeError(w, http.StatusNotFound, "NotFound", r.URL.Path)
+	}
+}
+
+func (s *Server) createAlias(w http.ResponseWriter, r *http.Request, serviceName string) {
+	var alias Object
+	if err := json.NewDecoder(r.Body).Decode(&alias); err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	name, _ := alias["aliasName"].(string)
+	if s.findAlias(serviceName, name) >= 0 {
+		writeError(w, http.StatusConflict, "AliasAlreadyExists", name)
+		return
+	}
+	s.aliases[serviceName] = append(s.aliases[serviceName], alias)
+	writeAlias(w, http.StatusOK, alias)
+}
+
+// handleAlias gets, updates or deletes a single alias, updates and deletes are rejected
+// if If-Match header does not match etag of the alias.
+func (s *Server) handleAlias(w http.ResponseWriter, r *http.Request, serviceName string, aliasName string) {
+	i := s.findAlias(serviceName, aliasName)
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "AliasNotFound", aliasName)
+		return
+	}
+	alias := s.aliases[serviceName][i]
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != etag(alias) {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", aliasName)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeAlias(w, http.StatusOK, alias)
+	case http.MethodPut:
+		var update Object
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", err.Error())
+			return
+		}
+		updated := Object{}
+		for k, v := range alias {
+			updated[k] = v
+		}
+		for k, v := range update {
+			if v != nil {
+				updated[k] = v
+			}
+		}
+		s.aliases[serviceName][i] = updated
+		writeAlias(w, http.StatusOK, updated)
+	case http.MethodDelete:
+		aliases := s.aliases[serviceName]
+		s.aliases[serviceName] = append(aliases[:i:i], aliases[i+1:]...)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+func (s *Server) findAlias(serviceName string, aliasName string) int {
+	for i, alias := range s.aliases[serviceName] {
+		if alias["aliasName"] == aliasName {
+			return i
+		}
+	}
+	return -1
+}
+
+// etag is derived from content of object, so it changes with every update.
+func etag(o Object) string {
+	b, _ := json.Marshal(o)
+	return fmt.Sprintf("%x", md5.Sum(b))
+}
+
+func writeAlias(w http.ResponseWriter, status int, alias Object) {
+	w.Header().Set("ETag", etag(alias))
+	writeJSON(w, status, alias)
+}
+
+// writePage uses offset of the next page as nextToken, limit is capped by PageSize.
+func (s *Server) writePage(w http.ResponseWriter, r *http.Request, key string, items []Object) {
+	start, _ := strconv.Atoi(r.URL.Query().Get("nextToken"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > s.PageSize {
+		limit = s.PageSize
+	}
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	page := Object{key: items[start:end]}
+	if end < len(items) {
+		page["nextToken"] = strconv.Itoa(end)
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, Object{"ErrorCode": code, "ErrorMessage": message})
+}
@@ -0,0 +1,102 @@
+package fcapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aliyun/fc-go-sdk"
+)
+
+// Client sends signed requests to FC for APIs or fields not covered by fc-go-sdk,
+// it shares endpoint and credentials with the sdk client.
+type Client struct {
+	config     *fc.Config
+	httpClient *http.Client
+}
+
+func NewClient(client *fc.Client) *Client {
+	return &Client{
+		config: client.Config,
+		httpClient: &http.Client{
+			Timeout: time.Duration(client.Config.Timeout) * time.Second,
+		},
+	}
+}
+
+func (c *Client) do(method string, path string, query url.Values, in interface{}, out interface{}) error {
+	path = "/" + c.config.APIVersion + path
+	headers := map[string]string{
+		"Accept":               "application/json",
+		fc.HTTPHeaderUserAgent: c.config.UserAgent,
+		fc.HTTPHeaderDate:      time.Now().UTC().Format(http.TimeFormat),
+	}
+	if c.config.AccountID != "" {
+		headers[fc.HTTPHeaderAccountID] = c.config.AccountID
+	}
+	if c.config.SecurityToken != "" {
+		headers[fc.HTTPHeaderSecurityToken] = c.config.SecurityToken
+	}
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		headers[fc.HTTPHeaderContentType] = "application/json"
+		headers[fc.HTTPHeaderContentMD5] = fc.MD5(body)
+	}
+	headers["Authorization"] = fc.GetAuthStr(c.config.AccessKeyID, c.config.AccessKeySecret, method, headers, path)
+
+	u := c.config.Endpoint + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		serviceError := &fc.ServiceError{
+			HTTPStatus: resp.StatusCode,
+			RequestID:  resp.Header.Get(fc.HTTPHeaderRequestID),
+		}
+		_ = json.Unmarshal(content, serviceError)
+		return serviceError
+	}
+	if out != nil && len(content) > 0 {
+		return json.Unmarshal(content, out)
+	}
+	return nil
+}
+
+func IsNotFound(err error) bool {
+	serviceError, ok := err.(*fc.ServiceError)
+	return ok && serviceError.HTTPStatus == http.StatusNotFound
+}
+
+func IsConflict(err error) bool {
+	serviceError, ok := err.(*fc.ServiceError)
+	return ok && serviceError.HTTPStatus == http.StatusConflict
+}
+
+func IsPreconditionFailed(err error) bool {
+	serviceError, ok := err.(*fc.ServiceError)
+	return ok && serviceError.HTTPStatus == http.StatusPreconditionFailed
+}
@@ -0,0 +1,114 @@
+package fcapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type RewriteRule struct {
+	Match       string `json:"match"`
+	Replacement string `json:"replacement"`
+}
+
+type RewriteConfig struct {
+	EqualRules    []RewriteRule `json:"equalRules,omitempty"`
+	WildcardRules []RewriteRule `json:"wildcardRules,omitempty"`
+	RegexRules    []RewriteRule `json:"regexRules,omitempty"`
+}
+
+type PathConfig struct {
+	Path          string         `json:"path"`
+	ServiceName   string         `json:"serviceName"`
+	FunctionName  string         `json:"functionName"`
+	Qualifier     string         `json:"qualifier,omitempty"`
+	Methods       []string       `json:"methods,omitempty"`
+	RewriteConfig *RewriteConfig `json:"rewriteConfig,omitempty"`
+}
+
+type RouteConfig struct {
+	Routes []PathConfig `json:"routes"`
+}
+
+type CertConfig struct {
+	CertName    string `json:"certName"`
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"privateKey,omitempty"`
+}
+
+type TLSConfig struct {
+	MinVersion   string   `json:"minVersion,omitempty"`
+	MaxVersion   string   `json:"maxVersion,omitempty"`
+	CipherSuites []string `json:"cipherSuites,omitempty"`
+}
+
+type WAFConfig struct {
+	EnableWAF bool `json:"enableWAF"`
+}
+
+type CustomDomain struct {
+	DomainName       string       `json:"domainName"`
+	Protocol         string       `json:"protocol,omitempty"`
+	RouteConfig      *RouteConfig `json:"routeConfig,omitempty"`
+	CertConfig       *CertConfig  `json:"certConfig,omitempty"`
+	TLSConfig        *TLSConfig   `json:"tlsConfig,omitempty"`
+	WAFConfig        *WAFConfig   `json:"wafConfig,omitempty"`
+	CreatedTime      string       `json:"createdTime,omitempty"`
+	LastModifiedTime string       `json:"lastModifiedTime,omitempty"`
+}
+
+func customDomainPath(domainName string) string {
+	return fmt.Sprintf("/custom-domains/%s", url.PathEscape(domainName))
+}
+
+func (c *Client) GetCustomDomain(domainName string) (*CustomDomain, error) {
+	var domain CustomDomain
+	if err := c.do(http.MethodGet, customDomainPath(domainName), nil, nil, &domain); err != nil {
+		return nil, err
+	}
+	return &domain, nil
+}
+
+func (c *Client) CreateCustomDomain(domain *CustomDomain) error {
+	return c.do(http.MethodPost, "/custom-domains", nil, domain, nil)
+}
+
+func (c *Client) UpdateCustomDomain(domain *CustomDomain) error {
+	// domainName is part of path, not allowed in body of update
+	update := struct {
+		Protocol    string       `json:"protocol,omitempty"`
+		RouteConfig *RouteConfig `json:"routeConfig,omitempty"`
+		CertConfig  *CertConfig  `json:"certConfig,omitempty"`
+		TLSConfig   *TLSConfig   `json:"tlsConfig,omitempty"`
+		WAFConfig   *WAFConfig   `json:"wafConfig,omitempty"`
+	}{domain.Protocol, domain.RouteConfig, domain.CertConfig, domain.TLSConfig, domain.WAFConfig}
+	return c.do(http.MethodPut, customDomainPath(domain.DomainName), nil, update, nil)
+}
+
+// ListCustomDomains lists all custom domains, following nextToken.
+func (c *Client) ListCustomDomains() ([]CustomDomain, error) {
+	type customDomainsPage struct {
+		CustomDomains []CustomDomain `json:"customDomains"`
+		NextToken     *string        `json:"nextToken"`
+	}
+	query := url.Values{}
+	query.Set("limit", "100")
+	output, err := listAll(func(nextToken *string) (*customDomainsPage, error) {
+		if nextToken != nil {
+			query.Set("nextToken", *nextToken)
+		}
+		var page customDomainsPage
+		if err := c.do(http.MethodGet, "/custom-domains", query, nil, &page); err != nil {
+			return nil, err
+		}
+		return &page, nil
+	}, func(page *customDomainsPage) **string {
+		return &page.NextToken
+	}, func(output, page *customDomainsPage) {
+		output.CustomDomains = append(output.CustomDomains, page.CustomDomains...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.CustomDomains, nil
+}
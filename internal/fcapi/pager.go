@@ -0,0 +1,115 @@
+package fcapi
+
+import (
+	"github.com/aliyun/fc-go-sdk"
+)
+
+// ListAll* page through all results by following NextToken, and return
+// results of all pages merged into one output. NextToken of input is modified.
+
+const pageLimit = 100
+
+type ServiceVersionLister interface {
+	ListServiceVersions(input *fc.ListServiceVersionsInput) (*fc.ListServiceVersionsOutput, error)
+}
+
+type AliasLister interface {
+	ListAliases(input *fc.ListAliasesInput) (*fc.ListAliasesOutput, error)
+}
+
+type TriggerLister interface {
+	ListTriggers(input *fc.ListTriggersInput) (*fc.ListTriggersOutput, error)
+}
+
+type ProvisionConfigLister interface {
+	ListProvisionConfigs(input *fc.ListProvisionConfigsInput) (*fc.ListProvisionConfigsOutput, error)
+}
+
+// listAll calls list with NextToken of the previous page, nil for the first page, until the last page.
+// next returns NextToken field of a page, so that it is cleared in the merged output, and merge
+// appends items of later pages to the first one.
+func listAll[O any](list func(nextToken *string) (O, error), next func(O) **string, merge func(output O, page O)) (O, error) {
+	var output O
+	var nextToken *string
+	for first := true; ; first = false {
+		page, err := list(nextToken)
+		if err != nil {
+			var zero O
+			return zero, err
+		}
+		if first {
+			output = page
+		} else {
+			merge(output, page)
+		}
+		nextToken = *next(page)
+		if nextToken == nil || *nextToken == "" {
+			*next(output) = nil
+			return output, nil
+		}
+	}
+}
+
+func ListAllServiceVersions(client ServiceVersionLister, input *fc.ListServiceVersionsInput) (*fc.ListServiceVersionsOutput, error) {
+	if input.Limit == nil {
+		input.WithLimit(pageLimit)
+	}
+	return listAll(func(nextToken *string) (*fc.ListServiceVersionsOutput, error) {
+		if nextToken != nil {
+			input.WithNextToken(*nextToken)
+		}
+		return client.ListServiceVersions(input)
+	}, func(page *fc.ListServiceVersionsOutput) **string {
+		return &page.NextToken
+	}, func(output, page *fc.ListServiceVersionsOutput) {
+		output.Versions = append(output.Versions, page.Versions...)
+	})
+}
+
+func ListAllAliases(client AliasLister, input *fc.ListAliasesInput) (*fc.ListAliasesOutput, error) {
+	if input.Limit == nil {
+		input.WithLimit(pageLimit)
+	}
+	return listAll(func(nextToken *string) (*fc.ListAliasesOutput, error) {
+		if nextToken != nil {
+			input.WithNextToken(*nextToken)
+		}
+		return client.ListAliases(input)
+	}, func(page *fc.ListAliasesOutput) **string {
+		return &page.NextToken
+	}, func(output, page *fc.ListAliasesOutput) {
+		output.Aliases = append(output.Aliases, page.Aliases...)
+	})
+}
+
+func ListAllTriggers(client TriggerLister, input *fc.ListTriggersInput) (*fc.ListTriggersOutput, error) {
+	if input.Limit == nil {
+		input.WithLimit(pageLimit)
+	}
+	return listAll(func(nextToken *string) (*fc.ListTriggersOutput, error) {
+		if nextToken != nil {
+			input.WithNextToken(*nextToken)
+		}
+		return client.ListTriggers(input)
+	}, func(page *fc.ListTriggersOutput) **string {
+		return &page.NextToken
+	}, func(output, page *fc.ListTriggersOutput) {
+		output.Triggers = append(output.Triggers, page.Triggers...)
+	})
+}
+
+func ListAllProvisionConfigs(client ProvisionConfigLister, input *fc.ListProvisionConfigsInput) (*fc.ListProvisionConfigsOutput, error) {
+	if input.Limit == nil {
+		input.WithLimit(pageLimit)
+	}
+	return listAll(func(nextToken *string) (*fc.ListProvisionConfigsOutput, error) {
+		if nextToken != nil {
+			input.WithNextToken(*nextToken)
+		}
+		return client.ListProvisionConfigs(input)
+	}, func(page *fc.ListProvisionConfigsOutput) **string {
+		return &page.NextToken
+	}, func(output, page *fc.ListProvisionConfigsOutput) {
+		output.ProvisionConfigs = append(output.ProvisionConfigs, page.ProvisionConfigs...)
+	})
+}
@@ -0,0 +1,57 @@
+package fcapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type ScheduledAction struct {
+	Name               string `json:"name"`
+	StartTime          string `json:"startTime,omitempty"`
+	EndTime            string `json:"endTime,omitempty"`
+	Target             int64  `json:"target"`
+	ScheduleExpression string `json:"scheduleExpression"`
+}
+
+type TargetTrackingPolicy struct {
+	Name         string  `json:"name"`
+	StartTime    string  `json:"startTime,omitempty"`
+	EndTime      string  `json:"endTime,omitempty"`
+	MetricType   string  `json:"metricType"`
+	MetricTarget float64 `json:"metricTarget"`
+	MinCapacity  int64   `json:"minCapacity"`
+	MaxCapacity  int64   `json:"maxCapacity"`
+}
+
+// ProvisionConfig is sent with empty but non-nil lists to remove existing scheduled actions and policies.
+type ProvisionConfig struct {
+	Target                 int64                  `json:"target"`
+	Current                int64                  `json:"current,omitempty"`
+	ScheduledActions       []ScheduledAction      `json:"scheduledActions"`
+	TargetTrackingPolicies []TargetTrackingPolicy `json:"targetTrackingPolicies"`
+}
+
+func provisionConfigPath(serviceName, qualifier, functionName string) string {
+	return fmt.Sprintf("/services/%s.%s/functions/%s/provision-config", url.PathEscape(serviceName), url.PathEscape(qualifier), url.PathEscape(functionName))
+}
+
+func (c *Client) GetProvisionConfig(serviceName, qualifier, functionName string) (*ProvisionConfig, error) {
+	var config ProvisionConfig
+	if err := c.do(http.MethodGet, provisionConfigPath(serviceName, qualifier, functionName), nil, nil, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (c *Client) PutProvisionConfig(serviceName, qualifier, functionName string, config *ProvisionConfig) error {
+	body := *config
+	body.Current = 0
+	if body.ScheduledActions == nil {
+		body.ScheduledActions = []ScheduledAction{}
+	}
+	if body.TargetTrackingPolicies == nil {
+		body.TargetTrackingPolicies = []TargetTrackingPolicy{}
+	}
+	return c.do(http.MethodPut, provisionConfigPath(serviceName, qualifier, functionName), nil, body, nil)
+}
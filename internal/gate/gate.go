@@ -0,0 +1,89 @@
+package gate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/aliyun/fc-go-sdk"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/smoke"
+)
+
+// Gate invokes function with payload and checks the response.
+type Gate struct {
+	Name        string `yaml:"Name"`
+	Payload     string `yaml:"Payload"`
+	PayloadFile string `yaml:"PayloadFile"`
+	// ExpectErrorType is the expected X-Fc-Error-Type, empty means the invocation should succeed
+	ExpectErrorType string                 `yaml:"ExpectErrorType"`
+	ExpectBody      string                 `yaml:"ExpectBody"`
+	ExpectJSON      map[string]interface{} `yaml:"ExpectJSON"`
+	// MaxDuration is the max duration of invocation, 0 for no limit
+	MaxDuration time.Duration `yaml:"MaxDuration"`
+}
+
+func (g Gate) String() string {
+	if g.Name != "" {
+		return g.Name
+	}
+	if g.PayloadFile != "" {
+		return g.PayloadFile
+	}
+	return "invoke"
+}
+
+type Invoker interface {
+	InvokeFunction(input *fc.InvokeFunctionInput) (*fc.InvokeFunctionOutput, error)
+}
+
+// Run invokes qualifier of function synchronously, relative PayloadFile is resolved against baseDir.
+func Run(invoker Invoker, serviceName string, qualifier string, functionName string, g Gate, baseDir string) error {
+	payload := []byte(g.Payload)
+	if g.PayloadFile != "" {
+		filename := g.PayloadFile
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(baseDir, filename)
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		payload = data
+	}
+	input := fc.NewInvokeFunctionInput(serviceName, functionName).
+		WithQualifier(qualifier).
+		WithSyncInvocation().
+		WithPayload(payload)
+	start := time.Now()
+	output, err := invoker.InvokeFunction(input)
+	duration := time.Since(start)
+	if err != nil {
+		return err
+	}
+	if errorType := output.GetErrorType(); errorType != g.ExpectErrorType {
+		if g.ExpectErrorType == "" {
+			return fmt.Errorf("invocation failed with %s: %s", errorType, output.Payload)
+		}
+		return fmt.Errorf("expect error type %q, got %q", g.ExpectErrorType, errorType)
+	}
+	if g.MaxDuration > 0 && duration > g.MaxDuration {
+		return fmt.Errorf("invocation took %s, exceeds %s", duration, g.MaxDuration)
+	}
+	if g.ExpectBody != "" {
+		re, err := regexp.Compile(g.ExpectBody)
+		if err != nil {
+			return err
+		}
+		if !re.Match(output.Payload) {
+			return fmt.Errorf("response does not match %q", g.ExpectBody)
+		}
+	}
+	if len(g.ExpectJSON) > 0 {
+		if err = smoke.MatchJSON(output.Payload, g.ExpectJSON); err != nil {
+			return err
+		}
+	}
+	return nil
+}
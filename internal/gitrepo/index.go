@@ -0,0 +1,211 @@
+package gitrepo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	modeTypeMask = 0170000
+	modeTree     = 0040000
+	modeRegular  = 0100000
+	modeSymlink  = 0120000
+	modeGitlink  = 0160000
+
+	flagAssumeValid  = 0x8000
+	flagExtended     = 0x4000
+	flagStageMask    = 0x3000
+	flagSkipWorktree = 0x4000
+)
+
+func newHash() hash.Hash {
+	return sha1.New()
+}
+
+type indexEntry struct {
+	MTimeSec  uint32
+	MTimeNsec uint32
+	Mode      uint32
+	Size      uint32
+	SHA       string
+	Flags     uint16
+	Extended  uint16
+	Path      string
+}
+
+func (r *Repo) readIndex() ([]indexEntry, error) {
+	data, err := os.ReadFile(filepath.Join(r.GitDir, "index"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(data) < 12 || string(data[:4]) != "DIRC" {
+		return nil, fmt.Errorf("invalid git index")
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("unsupported git index version %d", version)
+	}
+	n := int(binary.BigEndian.Uint32(data[8:12]))
+	entries := make([]indexEntry, 0, n)
+	pos := 12
+	var prevPath string
+	for i := 0; i < n; i++ {
+		if pos+62 > len(data) {
+			return nil, fmt.Errorf("truncated git index")
+		}
+		start := pos
+		e := indexEntry{
+			MTimeSec:  binary.BigEndian.Uint32(data[pos+8:]),
+			MTimeNsec: binary.BigEndian.Uint32(data[pos+12:]),
+			Mode:      binary.BigEndian.Uint32(data[pos+24:]),
+			Size:      binary.BigEndian.Uint32(data[pos+36:]),
+			SHA:       hex.EncodeToString(data[pos+40 : pos+60]),
+			Flags:     binary.BigEndian.Uint16(data[pos+60:]),
+		}
+		pos += 62
+		if version >= 3 && e.Flags&flagExtended != 0 {
+			e.Extended = binary.BigEndian.Uint16(data[pos:])
+			pos += 2
+		}
+		if version == 4 {
+			// prefix compressed path: varint of bytes to strip from previous path
+			strip, m := readOffsetVarint(data[pos:])
+			pos += m
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 || int(strip) > len(prevPath) {
+				return nil, fmt.Errorf("invalid git index entry")
+			}
+			e.Path = prevPath[:len(prevPath)-int(strip)] + string(data[pos:pos+end])
+			pos += end + 1
+		} else {
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return nil, fmt.Errorf("invalid git index entry")
+			}
+			e.Path = string(data[pos : pos+end])
+			// entries are padded with 1-8 NUL bytes to a multiple of 8
+			pos = start + ((pos+end-start)+8)&^7
+		}
+		prevPath = e.Path
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func readOffsetVarint(data []byte) (uint64, int) {
+	var value uint64
+	for i, b := range data {
+		value = (value << 7) | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			return value, i + 1
+		}
+		value++
+	}
+	return value, len(data)
+}
+
+// Dirty reports files tracked in the index that are modified or deleted in the working tree,
+// and files with changes staged but not committed, i.e. index differs from tree of HEAD.
+// Untracked files are ignored as "git describe --dirty" does.
+func (r *Repo) Dirty() ([]string, error) {
+	entries, err := r.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	tree, err := r.headTree()
+	if err != nil {
+		return nil, err
+	}
+	var dirty []string
+	for _, e := range entries {
+		t, committed := tree[e.Path]
+		delete(tree, e.Path)
+		if e.Flags&flagStageMask != 0 {
+			// unmerged entry, one for each stage
+			if len(dirty) == 0 || dirty[len(dirty)-1] != e.Path {
+				dirty = append(dirty, e.Path)
+			}
+			continue
+		}
+		if !committed || t.SHA != e.SHA || normalizeMode(t.Mode) != normalizeMode(e.Mode) {
+			// staged
+			dirty = append(dirty, e.Path)
+			continue
+		}
+		if e.Flags&flagAssumeValid != 0 || e.Extended&flagSkipWorktree != 0 {
+			continue
+		}
+		if e.Mode&modeTypeMask == modeGitlink {
+			continue
+		}
+		changed, err := r.entryChanged(e)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			dirty = append(dirty, e.Path)
+		}
+	}
+	// removed from index but not committed
+	for path := range tree {
+		dirty = append(dirty, path)
+	}
+	sort.Strings(dirty)
+	return dirty, nil
+}
+
+// normalizeMode keeps only the executable bit of regular files, as git does.
+func normalizeMode(mode uint32) uint32 {
+	if mode&modeTypeMask != modeRegular {
+		return mode & modeTypeMask
+	}
+	if mode&0111 != 0 {
+		return modeRegular | 0755
+	}
+	return modeRegular | 0644
+}
+
+func (r *Repo) entryChanged(e indexEntry) (bool, error) {
+	filename := filepath.Join(r.WorkDir, filepath.FromSlash(e.Path))
+	fi, err := os.Lstat(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	var content []byte
+	if e.Mode&modeTypeMask == modeSymlink {
+		target, err := os.Readlink(filename)
+		if err != nil {
+			return true, nil
+		}
+		content = []byte(filepath.ToSlash(target))
+	} else {
+		if !fi.Mode().IsRegular() {
+			return true, nil
+		}
+		if uint32(fi.Size()) != e.Size {
+			return true, nil
+		}
+		mtime := fi.ModTime()
+		if uint32(mtime.Unix()) == e.MTimeSec && uint32(mtime.Nanosecond()) == e.MTimeNsec {
+			return false, nil
+		}
+		content, err = os.ReadFile(filename)
+		if err != nil {
+			return false, err
+		}
+	}
+	return blobSHA(content) != e.SHA, nil
+}
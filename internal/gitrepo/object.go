@@ -0,0 +1,341 @@
+package gitrepo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var errObjectNotFound = errors.New("object not found")
+
+var packTypes = map[byte]string{
+	1: "commit",
+	2: "tree",
+	3: "blob",
+	4: "tag",
+}
+
+func (r *Repo) readObject(sha string) (string, []byte, error) {
+	if !isSHA(sha) {
+		return "", nil, fmt.Errorf("invalid object id %s", sha)
+	}
+	typ, content, err := r.readLooseObject(sha)
+	if err == nil || !os.IsNotExist(err) {
+		return typ, content, err
+	}
+	return r.readPackedObject(sha)
+}
+
+func (r *Repo) readLooseObject(sha string) (string, []byte, error) {
+	f, err := os.Open(filepath.Join(r.CommonDir, "objects", sha[:2], sha[2:]))
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return "", nil, err
+	}
+	i := bytes.IndexByte(data, 0)
+	if i < 0 {
+		return "", nil, fmt.Errorf("invalid object %s", sha)
+	}
+	header := strings.SplitN(string(data[:i]), " ", 2)
+	return header[0], data[i+1:], nil
+}
+
+func (r *Repo) readPackedObject(sha string) (string, []byte, error) {
+	id, err := hex.DecodeString(sha)
+	if err != nil {
+		return "", nil, err
+	}
+	indexes, err := filepath.Glob(filepath.Join(r.CommonDir, "objects", "pack", "*.idx"))
+	if err != nil {
+		return "", nil, err
+	}
+	for _, idx := range indexes {
+		offset, err := findPackOffset(idx, id)
+		if err == errObjectNotFound {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		return r.readPackEntry(strings.TrimSuffix(idx, ".idx")+".pack", offset, 0)
+	}
+	return "", nil, fmt.Errorf("object %s: %w", sha, errObjectNotFound)
+}
+
+// findPackOffset looks up id in a version 2 pack index.
+func findPackOffset(filename string, id []byte) (int64, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) < 8+256*4 || !bytes.Equal(data[:4], []byte{0xff, 't', 'O', 'c'}) || binary.BigEndian.Uint32(data[4:8]) != 2 {
+		return 0, fmt.Errorf("unsupported pack index %s", filename)
+	}
+	fanout := data[8 : 8+256*4]
+	n := int(binary.BigEndian.Uint32(fanout[255*4:]))
+	lo := 0
+	if id[0] > 0 {
+		lo = int(binary.BigEndian.Uint32(fanout[(int(id[0])-1)*4:]))
+	}
+	hi := int(binary.BigEndian.Uint32(fanout[int(id[0])*4:]))
+	names := data[8+256*4:]
+	crcs := names[n*20:]
+	offsets := crcs[n*4:]
+	largeOffsets := offsets[n*4:]
+	for lo < hi {
+		mid := (lo + hi) / 2
+		switch cmp := bytes.Compare(names[mid*20:mid*20+20], id); {
+		case cmp == 0:
+			offset := binary.BigEndian.Uint32(offsets[mid*4:])
+			if offset&0x80000000 == 0 {
+				return int64(offset), nil
+			}
+			i := int(offset & 0x7fffffff)
+			return int64(binary.BigEndian.Uint64(largeOffsets[i*8:])), nil
+		case cmp < 0:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return 0, errObjectNotFound
+}
+
+// maxDeltaDepth limits chains of deltified objects, git uses 50 by default.
+const maxDeltaDepth = 1000
+
+const (
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+// readPackEntry reads object from pack at offset, deltified objects are resolved against
+// their bases in the same pack (ofs-delta) or anywhere in the repository (ref-delta).
+func (r *Repo) readPackEntry(filename string, offset int64, depth int) (string, []byte, error) {
+	if depth > maxDeltaDepth {
+		return "", nil, fmt.Errorf("too deep delta chain at %s:%d", filepath.Base(filename), offset)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return "", nil, err
+	}
+	br := bufio.NewReader(f)
+	b, err := br.ReadByte()
+	if err != nil {
+		return "", nil, err
+	}
+	packType := (b >> 4) & 0x07
+	size := int64(b & 0x0f)
+	shift := uint(4)
+	for b&0x80 != 0 {
+		if b, err = br.ReadByte(); err != nil {
+			return "", nil, err
+		}
+		size |= int64(b&0x7f) << shift
+		shift += 7
+	}
+	var typ string
+	var base []byte
+	switch packType {
+	case packOfsDelta:
+		// offset of base relative to this entry, big-endian with an added 1 for each continuation
+		if b, err = br.ReadByte(); err != nil {
+			return "", nil, err
+		}
+		rel := int64(b & 0x7f)
+		for b&0x80 != 0 {
+			if b, err = br.ReadByte(); err != nil {
+				return "", nil, err
+			}
+			rel = ((rel + 1) << 7) | int64(b&0x7f)
+		}
+		typ, base, err = r.readPackEntry(filename, offset-rel, depth+1)
+	case packRefDelta:
+		id := make([]byte, 20)
+		if _, err = io.ReadFull(br, id); err != nil {
+			return "", nil, err
+		}
+		typ, base, err = r.readObject(hex.EncodeToString(id))
+	default:
+		var ok bool
+		if typ, ok = packTypes[packType]; !ok {
+			return "", nil, fmt.Errorf("unsupported pack object type %d at %s:%d", packType, filepath.Base(filename), offset)
+		}
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zr.Close()
+	content := make([]byte, size)
+	if _, err = io.ReadFull(zr, content); err != nil {
+		return "", nil, err
+	}
+	if base != nil {
+		content, err = applyDelta(base, content)
+	}
+	return typ, content, err
+}
+
+// applyDelta applies git delta to base: sizes of base and result, followed by
+// instructions to copy ranges of base or to insert literal data.
+func applyDelta(base []byte, delta []byte) ([]byte, error) {
+	errInvalid := errors.New("invalid delta")
+	baseSize, n := deltaSize(delta)
+	if n == 0 || baseSize != len(base) {
+		return nil, errInvalid
+	}
+	delta = delta[n:]
+	resultSize, n := deltaSize(delta)
+	if n == 0 {
+		return nil, errInvalid
+	}
+	delta = delta[n:]
+	result := make([]byte, 0, resultSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			var offset, size int
+			for i := 0; i < 7; i++ {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errInvalid
+				}
+				if i < 4 {
+					offset |= int(delta[0]) << (8 * i)
+				} else {
+					size |= int(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > len(base) {
+				return nil, errInvalid
+			}
+			result = append(result, base[offset:offset+size]...)
+		case op != 0:
+			if int(op) > len(delta) {
+				return nil, errInvalid
+			}
+			result = append(result, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errInvalid
+		}
+	}
+	if len(result) != resultSize {
+		return nil, errInvalid
+	}
+	return result, nil
+}
+
+func deltaSize(data []byte) (int, int) {
+	var size int
+	var shift uint
+	for i, b := range data {
+		size |= int(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			return size, i + 1
+		}
+	}
+	return 0, 0
+}
+
+type treeEntry struct {
+	Mode uint32
+	SHA  string
+}
+
+// headTree lists files of the commit HEAD points to, keyed by path.
+func (r *Repo) headTree() (map[string]treeEntry, error) {
+	head, err := r.Head()
+	if err != nil {
+		return nil, err
+	}
+	typ, content, err := r.readObject(head)
+	if err != nil {
+		return nil, err
+	}
+	line := strings.SplitN(string(content), "\n", 2)[0]
+	if typ != "commit" || !strings.HasPrefix(line, "tree ") {
+		return nil, fmt.Errorf("invalid commit object %s", head)
+	}
+	entries := make(map[string]treeEntry)
+	if err = r.readTree(strings.TrimPrefix(line, "tree "), "", entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// readTree adds blobs, symlinks and gitlinks of tree to entries recursively,
+// each tree entry is "<octal mode> <name>\x00<20 bytes id>".
+func (r *Repo) readTree(sha string, prefix string, entries map[string]treeEntry) error {
+	typ, content, err := r.readObject(sha)
+	if err != nil {
+		return err
+	}
+	if typ != "tree" {
+		return fmt.Errorf("invalid tree object %s", sha)
+	}
+	for len(content) > 0 {
+		sp := bytes.IndexByte(content, ' ')
+		nul := bytes.IndexByte(content, 0)
+		if sp < 0 || nul < sp || nul+21 > len(content) {
+			return fmt.Errorf("invalid tree object %s", sha)
+		}
+		mode, err := strconv.ParseUint(string(content[:sp]), 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid tree object %s", sha)
+		}
+		path := prefix + string(content[sp+1:nul])
+		id := hex.EncodeToString(content[nul+1 : nul+21])
+		content = content[nul+21:]
+		if uint32(mode)&modeTypeMask == modeTree {
+			if err = r.readTree(id, path+"/", entries); err != nil {
+				return err
+			}
+			continue
+		}
+		entries[path] = treeEntry{Mode: uint32(mode), SHA: id}
+	}
+	return nil
+}
+
+func blobSHA(content []byte) string {
+	h := newHash()
+	h.Write([]byte("blob " + strconv.Itoa(len(content)) + "\x00"))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
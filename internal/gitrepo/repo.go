@@ -0,0 +1,294 @@
+package gitrepo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver/v4"
+)
+
+var ErrNotRepository = errors.New("not a git repository")
+
+// Repo reads a git repository directly from the .git directory,
+// so that the git binary is not required.
+type Repo struct {
+	WorkDir   string
+	GitDir    string
+	CommonDir string
+}
+
+// Open finds the repository containing dir, walking up to the root.
+func Open(dir string) (*Repo, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		fi, err := os.Stat(dotGit)
+		if err == nil {
+			gitDir := dotGit
+			if !fi.IsDir() {
+				// worktree or submodule: "gitdir: <path>"
+				gitDir, err = readGitDirFile(dotGit)
+				if err != nil {
+					return nil, err
+				}
+			}
+			repo := &Repo{WorkDir: dir, GitDir: gitDir, CommonDir: gitDir}
+			if content, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+				commonDir := strings.TrimSpace(string(content))
+				if !filepath.IsAbs(commonDir) {
+					commonDir = filepath.Join(gitDir, commonDir)
+				}
+				repo.CommonDir = commonDir
+			}
+			return repo, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNotRepository
+		}
+		dir = parent
+	}
+}
+
+func readGitDirFile(filename string) (string, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return "", fmt.Errorf("invalid gitdir file %s", filename)
+	}
+	gitDir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(filename), gitDir)
+	}
+	return gitDir, nil
+}
+
+// Head returns the commit SHA that HEAD points to.
+func (r *Repo) Head() (string, error) {
+	content, err := os.ReadFile(filepath.Join(r.GitDir, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+	head := strings.TrimSpace(string(content))
+	if strings.HasPrefix(head, "ref:") {
+		return r.ResolveRef(strings.TrimSpace(strings.TrimPrefix(head, "ref:")))
+	}
+	if !isSHA(head) {
+		return "", fmt.Errorf("invalid HEAD: %s", head)
+	}
+	return head, nil
+}
+
+// ResolveRef resolves a full ref name like refs/heads/master to a SHA.
+func (r *Repo) ResolveRef(name string) (string, error) {
+	for i := 0; i < 10; i++ {
+		var content []byte
+		var err error
+		for _, dir := range []string{r.GitDir, r.CommonDir} {
+			content, err = os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			refs, err1 := r.packedRefs()
+			if err1 != nil {
+				return "", err1
+			}
+			for _, ref := range refs {
+				if ref.Name == name {
+					return ref.SHA, nil
+				}
+			}
+			return "", fmt.Errorf("can not resolve ref %s", name)
+		}
+		value := strings.TrimSpace(string(content))
+		if !strings.HasPrefix(value, "ref:") {
+			return value, nil
+		}
+		name = strings.TrimSpace(strings.TrimPrefix(value, "ref:"))
+	}
+	return "", fmt.Errorf("too many levels of symbolic refs for %s", name)
+}
+
+type ref struct {
+	Name   string
+	SHA    string
+	Peeled string
+}
+
+func (r *Repo) packedRefs() ([]ref, error) {
+	f, err := os.Open(filepath.Join(r.CommonDir, "packed-refs"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var refs []ref
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '^' {
+			if len(refs) > 0 {
+				refs[len(refs)-1].Peeled = line[1:]
+			}
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		refs = append(refs, ref{Name: fields[1], SHA: fields[0]})
+	}
+	return refs, scanner.Err()
+}
+
+func (r *Repo) tagRefs() ([]ref, error) {
+	refs, err := r.packedRefs()
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]ref)
+	for _, ref := range refs {
+		if strings.HasPrefix(ref.Name, "refs/tags/") {
+			tags[ref.Name] = ref
+		}
+	}
+	// loose refs take precedence over packed refs
+	tagsDir := filepath.Join(r.CommonDir, "refs", "tags")
+	err = filepath.Walk(tagsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(r.CommonDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		tags[name] = ref{Name: name, SHA: strings.TrimSpace(string(content))}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result []ref
+	for _, ref := range tags {
+		result = append(result, ref)
+	}
+	return result, nil
+}
+
+// TagsAt returns names (without refs/tags/) of tags pointing to commit,
+// both lightweight and annotated.
+func (r *Repo) TagsAt(commit string) ([]string, error) {
+	refs, err := r.tagRefs()
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, ref := range refs {
+		target := ref.SHA
+		if ref.Peeled != "" {
+			target = ref.Peeled
+		} else if target != commit {
+			peeled, err := r.peelTag(target)
+			if err != nil {
+				continue
+			}
+			target = peeled
+		}
+		if target == commit {
+			tags = append(tags, strings.TrimPrefix(ref.Name, "refs/tags/"))
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+func (r *Repo) peelTag(sha string) (string, error) {
+	for i := 0; i < 10; i++ {
+		typ, content, err := r.readObject(sha)
+		if err != nil {
+			return "", err
+		}
+		if typ != "tag" {
+			return sha, nil
+		}
+		line := strings.SplitN(string(content), "\n", 2)[0]
+		if !strings.HasPrefix(line, "object ") {
+			return "", fmt.Errorf("invalid tag object %s", sha)
+		}
+		sha = strings.TrimPrefix(line, "object ")
+	}
+	return "", fmt.Errorf("too many levels of tags for %s", sha)
+}
+
+// VersionTag returns the highest version-like tag pointing to HEAD,
+// tags are tried as semver after stripping a leading 'v'.
+func (r *Repo) VersionTag() (string, error) {
+	head, err := r.Head()
+	if err != nil {
+		return "", err
+	}
+	tags, err := r.TagsAt(head)
+	if err != nil {
+		return "", err
+	}
+	if len(tags) == 0 {
+		return "", fmt.Errorf("no tag points to HEAD %s", head)
+	}
+	var best string
+	var bestVer semver.Version
+	for _, tag := range tags {
+		ver, err := semver.Parse(strings.TrimPrefix(tag, "v"))
+		if err != nil {
+			continue
+		}
+		if best == "" || ver.GT(bestVer) {
+			best = tag
+			bestVer = ver
+		}
+	}
+	if best == "" {
+		best = tags[len(tags)-1]
+	}
+	return best, nil
+}
+
+func isSHA(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
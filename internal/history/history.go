@@ -0,0 +1,129 @@
+package history
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aliyun/fc-go-sdk"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/fcapi"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/lock"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/release"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/report"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/types"
+)
+
+// Entry is a published version of service, with metadata of the release read from its description.
+type Entry struct {
+	Region    string    `json:"region,omitempty" yaml:"region,omitempty"`
+	Service   string    `json:"service" yaml:"service"`
+	VersionID string    `json:"versionId" yaml:"versionId"`
+	Version   string    `json:"version" yaml:"version"`
+	Aliases   []string  `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+	Time      time.Time `json:"time" yaml:"time"`
+	Commit    string    `json:"commit,omitempty" yaml:"commit,omitempty"`
+	Operator  string    `json:"operator,omitempty" yaml:"operator,omitempty"`
+	RunURL    string    `json:"runUrl,omitempty" yaml:"runUrl,omitempty"`
+	Changelog string    `json:"changelog,omitempty" yaml:"changelog,omitempty"`
+	Dirty     bool      `json:"dirty,omitempty" yaml:"dirty,omitempty"`
+	Snapshot  bool      `json:"snapshot,omitempty" yaml:"snapshot,omitempty"`
+}
+
+// Load reconstructs release history of service from its versions and aliases, newest first.
+// Time of versions published before release time was recorded is their creation time.
+func Load(client *fc.Client, serviceName string) ([]Entry, error) {
+	versions, err := fcapi.ListAllServiceVersions(client, fc.NewListServiceVersionsInput(serviceName))
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := fcapi.ListAllAliases(client, fc.NewListAliasesInput(serviceName))
+	if err != nil {
+		return nil, err
+	}
+	aliasNames := make(map[string][]string)
+	for _, am := range aliases.Aliases {
+		if am.AliasName == nil || am.VersionID == nil || *am.AliasName == lock.AliasName {
+			continue
+		}
+		aliasNames[*am.VersionID] = append(aliasNames[*am.VersionID], *am.AliasName)
+	}
+	var entries []Entry
+	for _, vm := range versions.Versions {
+		if vm.VersionID == nil {
+			continue
+		}
+		var desc release.Description
+		if vm.Description != nil {
+			desc = release.ParseDescription(*vm.Description)
+		}
+		e := Entry{
+			Service:   serviceName,
+			VersionID: *vm.VersionID,
+			Version:   desc.Version,
+			Aliases:   aliasNames[*vm.VersionID],
+			Time:      desc.Time,
+			Commit:    desc.Commit,
+			Operator:  desc.Operator,
+			RunURL:    desc.RunURL,
+			Changelog: desc.Changelog,
+			Dirty:     desc.Dirty,
+			Snapshot:  desc.IsSnapshot(),
+		}
+		if e.Time.IsZero() && vm.CreatedTime != nil {
+			e.Time, _ = time.Parse(types.TimeLayout, *vm.CreatedTime)
+		}
+		sort.Strings(e.Aliases)
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.After(entries[j].Time)
+	})
+	return entries, nil
+}
+
+// Write writes entries as a table, or in json or yaml format.
+func Write(w io.Writer, format string, entries []Entry) error {
+	if format != "" {
+		if entries == nil {
+			entries = []Entry{}
+		}
+		return report.Encode(w, format, entries)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REGION\tSERVICE\tVERSION ID\tVERSION\tALIASES\tTIME\tCOMMIT\tOPERATOR\tRUN\tCHANGELOG")
+	for _, e := range entries {
+		var flags []string
+		if e.Snapshot {
+			flags = append(flags, "snapshot")
+		}
+		if e.Dirty {
+			flags = append(flags, "dirty")
+		}
+		version := e.Version
+		if len(flags) > 0 {
+			version += " (" + strings.Join(flags, ",") + ")"
+		}
+		var t string
+		if !e.Time.IsZero() {
+			t = e.Time.Local().Format(time.RFC3339)
+		}
+		commit := e.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		changelog := strings.SplitN(e.Changelog, "\n", 2)[0]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", dash(e.Region), e.Service, e.VersionID, dash(version),
+			dash(strings.Join(e.Aliases, ",")), dash(t), dash(commit), dash(e.Operator), dash(e.RunURL), dash(changelog))
+	}
+	return tw.Flush()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
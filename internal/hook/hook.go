@@ -0,0 +1,147 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Phase string
+
+const (
+	BeforePublish     Phase = "BeforePublish"
+	AfterAlias        Phase = "AfterAlias"
+	BeforeRouteSwitch Phase = "BeforeRouteSwitch"
+	AfterRelease      Phase = "AfterRelease"
+	OnFailure         Phase = "OnFailure"
+)
+
+var Phases = []Phase{BeforePublish, AfterAlias, BeforeRouteSwitch, AfterRelease, OnFailure}
+
+const defaultTimeout = 5 * time.Minute
+
+// Hook is either a shell command or a webhook, Command takes precedence if both are set.
+type Hook struct {
+	Name    string            `yaml:"Name"`
+	Command string            `yaml:"Command"`
+	URL     string            `yaml:"URL"`
+	Method  string            `yaml:"Method"`
+	Headers map[string]string `yaml:"Headers"`
+	// Timeout defaults to 5m
+	Timeout time.Duration `yaml:"Timeout"`
+}
+
+func (h Hook) String() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	if h.Command != "" {
+		return h.Command
+	}
+	return h.URL
+}
+
+// Metadata is passed to hooks, as environment variables and a json file to commands,
+// and as request body to webhooks.
+type Metadata struct {
+	Phase     Phase     `json:"phase"`
+	Version   string    `json:"version"`
+	Alias     string    `json:"alias"`
+	Commit    string    `json:"commit,omitempty"`
+	Region    string    `json:"region,omitempty"`
+	Services  []string  `json:"services"`
+	Snapshot  bool      `json:"snapshot"`
+	DryRun    bool      `json:"dryRun"`
+	StartTime time.Time `json:"startTime"`
+	Error     string    `json:"error,omitempty"`
+}
+
+func (m Metadata) Env() []string {
+	return []string{
+		"FC_RELEASE_PHASE=" + string(m.Phase),
+		"FC_RELEASE_VERSION=" + m.Version,
+		"FC_RELEASE_ALIAS=" + m.Alias,
+		"FC_RELEASE_COMMIT=" + m.Commit,
+		"FC_RELEASE_REGION=" + m.Region,
+		"FC_RELEASE_SERVICES=" + strings.Join(m.Services, ","),
+		"FC_RELEASE_SNAPSHOT=" + strconv.FormatBool(m.Snapshot),
+		"FC_RELEASE_DRY_RUN=" + strconv.FormatBool(m.DryRun),
+		"FC_RELEASE_ERROR=" + m.Error,
+	}
+}
+
+func (h Hook) Run(m Metadata) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if h.Command != "" {
+		return runCommand(ctx, h.Command, m, data)
+	}
+	if h.URL != "" {
+		return runWebhook(ctx, h, data)
+	}
+	return fmt.Errorf("hook %s has neither Command nor URL", h)
+}
+
+// runCommand runs command with sh, FC_RELEASE_METADATA is path of a json file of metadata.
+func runCommand(ctx context.Context, command string, m Metadata, data []byte) error {
+	f, err := os.CreateTemp("", "fc-release-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), m.Env()...)
+	cmd.Env = append(cmd.Env, "FC_RELEASE_METADATA="+f.Name())
+	// NOTE: stdout is reserved for the release report, output of hooks goes to stderr
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func runWebhook(ctx context.Context, h Hook, data []byte) error {
+	method := h.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned %d: %s", h, resp.StatusCode, body)
+	}
+	return nil
+}
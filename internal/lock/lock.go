@@ -0,0 +1,230 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliyun/fc-go-sdk"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/fcapi"
+)
+
+// AliasName is the alias holding the release lock of a service. Creating an alias fails if it
+// exists, so the lock is taken by whoever creates it first, and updating or deleting it with
+// the etag read before only succeeds if nobody changed it meanwhile.
+const AliasName = "release-lock"
+
+// Info is stored in description of the lock alias:
+// "lock owner=<url escaped owner> version=<version> expires=<RFC3339>", the leading "lock"
+// never parses as a release version, so the alias is ignored by other steps of release.
+type Info struct {
+	Owner   string
+	Version string
+	Expires time.Time
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("lock owner=%s version=%s expires=%s", url.QueryEscape(i.Owner), i.Version, i.Expires.UTC().Format(time.RFC3339))
+}
+
+// Expired reports whether the lock can be taken over by other owners.
+func (i Info) Expired(now time.Time) bool {
+	return !i.Expires.IsZero() && now.After(i.Expires)
+}
+
+// ParseInfo parses description of the lock alias, ok is false if s is not written by Info.String.
+func ParseInfo(s string) (info Info, ok bool) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || fields[0] != "lock" {
+		return info, false
+	}
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "owner":
+			info.Owner, _ = url.QueryUnescape(kv[1])
+		case "version":
+			info.Version = kv[1]
+		case "expires":
+			info.Expires, _ = time.Parse(time.RFC3339, kv[1])
+		}
+	}
+	return info, true
+}
+
+// LockedError is returned if the service is locked by another owner.
+type LockedError struct {
+	Service string
+	Info    Info
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("service %s is locked by %s releasing %s until %s, use force-unlock if the lock is stale",
+		e.Service, e.Info.Owner, e.Info.Version, e.Info.Expires.Local().Format(time.RFC3339))
+}
+
+// Locker locks services for releases of Owner, locks not released expire after TTL
+// so that crashed releases do not block others forever.
+type Locker struct {
+	client *fc.Client
+	Owner  string
+	TTL    time.Duration
+}
+
+func NewLocker(client *fc.Client, owner string, ttl time.Duration) *Locker {
+	return &Locker{client: client, Owner: owner, TTL: ttl}
+}
+
+// Status returns lock of service, ok is false if the service is not locked.
+func Status(client *fc.Client, serviceName string) (info Info, etag string, ok bool, err error) {
+	resp, err := client.GetAlias(fc.NewGetAliasInput(serviceName, AliasName))
+	if err != nil {
+		if fcapi.IsNotFound(err) {
+			return info, "", false, nil
+		}
+		return info, "", false, err
+	}
+	if resp.Description != nil {
+		info, _ = ParseInfo(*resp.Description)
+	}
+	return info, resp.GetEtag(), true, nil
+}
+
+// ErrNoVersion is returned by Lock if service has no published version for the lock alias to point to.
+var ErrNoVersion = errors.New("no published version to lock")
+
+// Lock locks service for release of version. A lock of the same owner is renewed and an expired
+// lock of other owners is taken over. The lock alias has to point to a published version, so
+// services without versions can not be locked, ErrNoVersion is returned for them.
+func (l *Locker) Lock(serviceName string, version string) error {
+	current, etag, exists, err := Status(l.client, serviceName)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if current.Owner != l.Owner && !current.Expired(time.Now()) {
+			return &LockedError{Service: serviceName, Info: current}
+		}
+		return l.update(serviceName, version, etag)
+	}
+	versionID, err := newestVersionID(l.client, serviceName)
+	if err != nil {
+		return err
+	}
+	if versionID == "" {
+		return fmt.Errorf("lock service %s: %w", serviceName, ErrNoVersion)
+	}
+	info := Info{Owner: l.Owner, Version: version, Expires: time.Now().Add(l.TTL)}
+	input := fc.NewCreateAliasInput(serviceName)
+	input.WithAliasName(AliasName)
+	input.WithVersionID(versionID)
+	input.WithDescription(info.String())
+	if _, err = l.client.CreateAlias(input); err != nil {
+		if fcapi.IsConflict(err) {
+			return l.lockedBy(serviceName)
+		}
+		return err
+	}
+	return nil
+}
+
+// ErrRemoved is returned by Renew if the lock has been removed, e.g. by force-unlock.
+var ErrRemoved = errors.New("lock has been removed")
+
+// Renew extends lock of service held by l for another TTL, unlike Lock it fails
+// if the lock has been removed, e.g. by force-unlock, or taken over.
+func (l *Locker) Renew(serviceName string, version string) error {
+	current, etag, exists, err := Status(l.client, serviceName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("renew lock of service %s: %w", serviceName, ErrRemoved)
+	}
+	if current.Owner != l.Owner {
+		return &LockedError{Service: serviceName, Info: current}
+	}
+	return l.update(serviceName, version, etag)
+}
+
+// update takes lock alias with etag for l, it fails if the alias has been changed since read.
+func (l *Locker) update(serviceName string, version string, etag string) error {
+	info := Info{Owner: l.Owner, Version: version, Expires: time.Now().Add(l.TTL)}
+	input := fc.NewUpdateAliasInput(serviceName, AliasName)
+	input.WithDescription(info.String())
+	input.WithIfMatch(etag)
+	if _, err := l.client.UpdateAlias(input); err != nil {
+		if fcapi.IsPreconditionFailed(err) {
+			return l.lockedBy(serviceName)
+		}
+		return err
+	}
+	return nil
+}
+
+// Unlock releases lock of service, the lock is kept if it has been taken over by another owner.
+func (l *Locker) Unlock(serviceName string) error {
+	current, etag, exists, err := Status(l.client, serviceName)
+	if err != nil || !exists {
+		return err
+	}
+	if current.Owner != l.Owner {
+		return fmt.Errorf("lock of service %s has been taken over by %s", serviceName, current.Owner)
+	}
+	input := fc.NewDeleteAliasInput(serviceName, AliasName)
+	input.WithIfMatch(etag)
+	_, err = l.client.DeleteAlias(input)
+	if fcapi.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// ForceUnlock removes lock of service regardless of its owner, it returns the removed lock.
+func ForceUnlock(client *fc.Client, serviceName string) (info Info, ok bool, err error) {
+	info, _, ok, err = Status(client, serviceName)
+	if err != nil || !ok {
+		return info, false, err
+	}
+	_, err = client.DeleteAlias(fc.NewDeleteAliasInput(serviceName, AliasName))
+	if fcapi.IsNotFound(err) {
+		return info, false, nil
+	}
+	return info, err == nil, err
+}
+
+func (l *Locker) lockedBy(serviceName string) error {
+	current, _, _, err := Status(l.client, serviceName)
+	if err != nil {
+		return err
+	}
+	return &LockedError{Service: serviceName, Info: current}
+}
+
+func newestVersionID(client *fc.Client, serviceName string) (string, error) {
+	resp, err := fcapi.ListAllServiceVersions(client, fc.NewListServiceVersionsInput(serviceName))
+	if err != nil {
+		return "", err
+	}
+	var newest string
+	var newestID int
+	for _, vm := range resp.Versions {
+		if vm.VersionID == nil {
+			continue
+		}
+		id, err := strconv.Atoi(*vm.VersionID)
+		if err != nil {
+			continue
+		}
+		if newest == "" || id > newestID {
+			newest, newestID = *vm.VersionID, id
+		}
+	}
+	return newest, nil
+}
@@ -0,0 +1,181 @@
+// Package logging is a leveled, structured logger following the API of log/slog,
+// which is not available in go 1.19.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch {
+	case l < LevelInfo:
+		return "DEBUG"
+	case l < LevelWarn:
+		return "INFO"
+	case l < LevelError:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+type output struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+	json  bool
+}
+
+// Logger writes records with its attributes, loggers derived by With share the output.
+type Logger struct {
+	out   *output
+	attrs []interface{}
+}
+
+func New(w io.Writer, level Level, format string) (*Logger, error) {
+	switch format {
+	case "", FormatText:
+	case FormatJSON:
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expect text or json", format)
+	}
+	return &Logger{out: &output{w: w, level: level, json: format == FormatJSON}}, nil
+}
+
+var defaultLogger = &Logger{out: &output{w: os.Stderr, level: LevelInfo}}
+
+func Default() *Logger {
+	return defaultLogger
+}
+
+func SetDefault(l *Logger) {
+	defaultLogger = l
+}
+
+// With returns a logger which adds args to each record, args are alternating keys and values.
+func (l *Logger) With(args ...interface{}) *Logger {
+	attrs := make([]interface{}, 0, len(l.attrs)+len(args))
+	attrs = append(attrs, l.attrs...)
+	attrs = append(attrs, args...)
+	return &Logger{out: l.out, attrs: attrs}
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.out.level
+}
+
+func (l *Logger) Log(level Level, msg string, args ...interface{}) { l.log(level, msg, args) }
+
+func (l *Logger) Debug(msg string, args ...interface{}) { l.log(LevelDebug, msg, args) }
+func (l *Logger) Info(msg string, args ...interface{})  { l.log(LevelInfo, msg, args) }
+func (l *Logger) Warn(msg string, args ...interface{})  { l.log(LevelWarn, msg, args) }
+func (l *Logger) Error(msg string, args ...interface{}) { l.log(LevelError, msg, args) }
+
+func (l *Logger) log(level Level, msg string, args []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	kvs := make([]interface{}, 0, len(l.attrs)+len(args))
+	kvs = append(kvs, l.attrs...)
+	kvs = append(kvs, args...)
+	if len(kvs)%2 == 1 {
+		kvs = append(kvs[:len(kvs)-1], "!BADKEY", kvs[len(kvs)-1])
+	}
+	now := time.Now()
+	var buf bytes.Buffer
+	if l.out.json {
+		buf.WriteString(`{"time":`)
+		writeJSON(&buf, now.Format(time.RFC3339Nano))
+		buf.WriteString(`,"level":`)
+		writeJSON(&buf, level.String())
+		buf.WriteString(`,"msg":`)
+		writeJSON(&buf, msg)
+		for i := 0; i < len(kvs); i += 2 {
+			buf.WriteByte(',')
+			writeJSON(&buf, fmt.Sprint(kvs[i]))
+			buf.WriteByte(':')
+			writeJSON(&buf, jsonValue(kvs[i+1]))
+		}
+		buf.WriteString("}\n")
+	} else {
+		buf.WriteString(now.Format("2006/01/02 15:04:05"))
+		buf.WriteByte(' ')
+		buf.WriteString(level.String())
+		buf.WriteByte(' ')
+		buf.WriteString(msg)
+		for i := 0; i < len(kvs); i += 2 {
+			buf.WriteByte(' ')
+			buf.WriteString(fmt.Sprint(kvs[i]))
+			buf.WriteByte('=')
+			buf.WriteString(textValue(kvs[i+1]))
+		}
+		buf.WriteByte('\n')
+	}
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	_, _ = l.out.w.Write(buf.Bytes())
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case error:
+		return x.Error()
+	case time.Duration:
+		return x.String()
+	case fmt.Stringer:
+		return x.String()
+	default:
+		return v
+	}
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(data)
+}
+
+func textValue(v interface{}) string {
+	s := fmt.Sprint(jsonValue(v))
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func With(args ...interface{}) *Logger { return defaultLogger.With(args...) }
+
+func Debug(msg string, args ...interface{}) { defaultLogger.log(LevelDebug, msg, args) }
+func Info(msg string, args ...interface{})  { defaultLogger.log(LevelInfo, msg, args) }
+func Warn(msg string, args ...interface{})  { defaultLogger.log(LevelWarn, msg, args) }
+func Error(msg string, args ...interface{}) { defaultLogger.log(LevelError, msg, args) }
+
+// Fatal logs at error level and exits with status 1.
+func Fatal(msg string, args ...interface{}) {
+	defaultLogger.log(LevelError, msg, args)
+	os.Exit(1)
+}
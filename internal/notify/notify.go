@@ -0,0 +1,190 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TypeDingTalk = "dingtalk"
+	TypeFeishu   = "feishu"
+	TypeWeCom    = "wecom"
+	TypeSlack    = "slack"
+	TypeWebhook  = "webhook"
+)
+
+// Config is a notifier in config file.
+type Config struct {
+	Type string `yaml:"type"`
+	URL  string `yaml:"url"`
+	// Secret signs requests of dingtalk and feishu robots
+	Secret      string `yaml:"secret,omitempty"`
+	OnlyFailure bool   `yaml:"only_failure,omitempty"`
+}
+
+// Summary is posted to notifiers after release.
+type Summary struct {
+	Version          string        `json:"version"`
+	Alias            string        `json:"alias"`
+	Region           string        `json:"region,omitempty"`
+	Services         []string      `json:"services"`
+	RouteChanges     []string      `json:"routeChanges,omitempty"`
+	ProvisionChanges []string      `json:"provisionChanges,omitempty"`
+	Duration         time.Duration `json:"duration"`
+	Error            string        `json:"error,omitempty"`
+}
+
+func (s Summary) Title() string {
+	if s.Error != "" {
+		return fmt.Sprintf("Release %s failed", s.Version)
+	}
+	return fmt.Sprintf("Release %s succeeded", s.Version)
+}
+
+// Text formats summary as markdown, which is also readable as plain text.
+func (s Summary) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### %s\n\n", s.Title())
+	fmt.Fprintf(&b, "- Alias: %s\n", s.Alias)
+	if s.Region != "" {
+		fmt.Fprintf(&b, "- Region: %s\n", s.Region)
+	}
+	fmt.Fprintf(&b, "- Services: %s\n", strings.Join(s.Services, ", "))
+	fmt.Fprintf(&b, "- Duration: %s\n", s.Duration.Round(time.Second))
+	if s.Error != "" {
+		fmt.Fprintf(&b, "- Error: %s\n", s.Error)
+	}
+	if len(s.RouteChanges) > 0 {
+		b.WriteString("\nRoute changes:\n")
+		for _, change := range s.RouteChanges {
+			fmt.Fprintf(&b, "- %s\n", change)
+		}
+	}
+	if len(s.ProvisionChanges) > 0 {
+		b.WriteString("\nProvision changes:\n")
+		for _, change := range s.ProvisionChanges {
+			fmt.Fprintf(&b, "- %s\n", change)
+		}
+	}
+	return b.String()
+}
+
+type Notifier interface {
+	Notify(s Summary) error
+}
+
+type notifier struct {
+	config Config
+	client *http.Client
+}
+
+func New(config Config) (Notifier, error) {
+	switch config.Type {
+	case TypeDingTalk, TypeFeishu, TypeWeCom, TypeSlack, TypeWebhook:
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", config.Type)
+	}
+	if config.URL == "" {
+		return nil, fmt.Errorf("url of %s notifier required", config.Type)
+	}
+	return &notifier{config: config, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func (n *notifier) Notify(s Summary) error {
+	if n.config.OnlyFailure && s.Error == "" {
+		return nil
+	}
+	target := n.config.URL
+	var body interface{}
+	now := time.Now()
+	switch n.config.Type {
+	case TypeDingTalk:
+		if n.config.Secret != "" {
+			timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+			sign := hmacBase64(n.config.Secret, timestamp+"\n"+n.config.Secret)
+			sep := "?"
+			if strings.Contains(target, "?") {
+				sep = "&"
+			}
+			target += sep + "timestamp=" + timestamp + "&sign=" + url.QueryEscape(sign)
+		}
+		body = map[string]interface{}{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"title": s.Title(), "text": s.Text()},
+		}
+	case TypeFeishu:
+		msg := map[string]interface{}{
+			"msg_type": "text",
+			"content":  map[string]string{"text": s.Text()},
+		}
+		if n.config.Secret != "" {
+			timestamp := strconv.FormatInt(now.Unix(), 10)
+			msg["timestamp"] = timestamp
+			msg["sign"] = hmacBase64(timestamp+"\n"+n.config.Secret, "")
+		}
+		body = msg
+	case TypeWeCom:
+		body = map[string]interface{}{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"content": s.Text()},
+		}
+	case TypeSlack:
+		body = map[string]string{"text": s.Text()}
+	default:
+		body = s
+	}
+	return n.post(target, body)
+}
+
+func hmacBase64(key string, message string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(message))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// post sends body as json, robots of dingtalk, wecom and feishu report errors in
+// response body with status 200.
+func (n *notifier) post(target string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(target, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s notifier returned %d: %s", n.config.Type, resp.StatusCode, respBody)
+	}
+	var result struct {
+		ErrCode *int   `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+		Code    *int   `json:"code"`
+		Msg     string `json:"msg"`
+	}
+	if json.Unmarshal(respBody, &result) != nil {
+		return nil
+	}
+	if result.ErrCode != nil && *result.ErrCode != 0 {
+		return fmt.Errorf("%s notifier returned error %d: %s", n.config.Type, *result.ErrCode, result.ErrMsg)
+	}
+	if result.Code != nil && *result.Code != 0 {
+		return fmt.Errorf("%s notifier returned error %d: %s", n.config.Type, *result.Code, result.Msg)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package provision
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/wsw0108/aliyun-fc-releaser/internal/types"
+	"gopkg.in/yaml.v3"
+)
+
+var scheduleRegex = regexp.MustCompile(`^(cron|at)\(.+\)$`)
+
+type ScheduledAction struct {
+	Name               string `yaml:"Name"`
+	StartTime          string `yaml:"StartTime"`
+	EndTime            string `yaml:"EndTime"`
+	Target             int64  `yaml:"Target"`
+	ScheduleExpression string `yaml:"ScheduleExpression"`
+}
+
+type TargetTrackingPolicy struct {
+	Name         string  `yaml:"Name"`
+	StartTime    string  `yaml:"StartTime"`
+	EndTime      string  `yaml:"EndTime"`
+	MetricType   string  `yaml:"MetricType"`
+	MetricTarget float64 `yaml:"MetricTarget"`
+	MinCapacity  int64   `yaml:"MinCapacity"`
+	MaxCapacity  int64   `yaml:"MaxCapacity"`
+}
+
+// Config is provisioned concurrency of a function, Target nil means not specified.
+type Config struct {
+	Target                 *int64                 `yaml:"Target"`
+	ScheduledActions       []ScheduledAction      `yaml:"ScheduledActions"`
+	TargetTrackingPolicies []TargetTrackingPolicy `yaml:"TargetTrackingPolicies"`
+}
+
+// UnmarshalYAML accepts a plain number as shorthand of Target.
+func (c *Config) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var target int64
+		if err := node.Decode(&target); err != nil {
+			return err
+		}
+		c.Target = &target
+		return nil
+	}
+	type config Config
+	return node.Decode((*config)(c))
+}
+
+func (c *Config) Validate() error {
+	if c.Target != nil && *c.Target < 0 {
+		return fmt.Errorf("invalid target %d", *c.Target)
+	}
+	for _, action := range c.ScheduledActions {
+		if action.Name == "" {
+			return fmt.Errorf("name of scheduled action required")
+		}
+		if !scheduleRegex.MatchString(action.ScheduleExpression) {
+			return fmt.Errorf("invalid schedule expression %q of scheduled action %s, expect cron(...) or at(...)", action.ScheduleExpression, action.Name)
+		}
+		if action.Target < 0 {
+			return fmt.Errorf("invalid target %d of scheduled action %s", action.Target, action.Name)
+		}
+	}
+	for _, policy := range c.TargetTrackingPolicies {
+		if policy.Name == "" {
+			return fmt.Errorf("name of target tracking policy required")
+		}
+		if policy.MetricType == "" {
+			return fmt.Errorf("metric type of target tracking policy %s required", policy.Name)
+		}
+		if policy.MetricTarget <= 0 || policy.MetricTarget > 1 {
+			return fmt.Errorf("invalid metric target %v of target tracking policy %s, expect (0, 1]", policy.MetricTarget, policy.Name)
+		}
+		if policy.MinCapacity < 0 || policy.MaxCapacity < policy.MinCapacity {
+			return fmt.Errorf("invalid capacity [%d, %d] of target tracking policy %s", policy.MinCapacity, policy.MaxCapacity, policy.Name)
+		}
+	}
+	return nil
+}
+
+// Spec is a sidecar file of provisioned concurrency, keyed by service and function name:
+//
+//	Services:
+//	  my-service:
+//	    my-function:
+//	      Target: 10
+//	    other-function: 0
+type Spec struct {
+	Services map[string]map[string]*Config `yaml:"Services"`
+}
+
+func LoadSpec(filename string) (*Spec, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var spec Spec
+	if err = yaml.NewDecoder(f).Decode(&spec); err != nil {
+		return nil, err
+	}
+	for serviceName, functions := range spec.Services {
+		for functionName, config := range functions {
+			if config == nil {
+				continue
+			}
+			if err = config.Validate(); err != nil {
+				return nil, fmt.Errorf("provision config of %s/%s: %w", serviceName, functionName, err)
+			}
+		}
+	}
+	return &spec, nil
+}
+
+// Check returns error if spec references service or function not in functions.
+func (s *Spec) Check(functions types.Functions) error {
+	if s == nil {
+		return nil
+	}
+	refs := make(map[string][]string)
+	for serviceName, fns := range s.Services {
+		refs[serviceName] = nil
+		for functionName := range fns {
+			refs[serviceName] = append(refs[serviceName], functionName)
+		}
+	}
+	return functions.CheckRefs("provision config", refs)
+}
+
+func (s *Spec) Get(serviceName string, functionName string) *Config {
+	if s == nil {
+		return nil
+	}
+	return s.Services[serviceName][functionName]
+}
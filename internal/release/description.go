@@ -0,0 +1,126 @@
+package release
+
+import (
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/blang/semver/v4"
+)
+
+// MaxLength is the max length of descriptions accepted by FC, the changelog is truncated to fit.
+const MaxLength = 256
+
+// Description is stored in descriptions of versions, aliases and triggers:
+// "<version> commit=<sha> time=<RFC3339>[ dirty=true][ snapshot=true][ operator=<operator>]
+// [ run=<url>][ changelog=<changelog>]", the version comes first so that descriptions written
+// before containing only the version still parse. Whitespaces and "%" in operator, run and
+// changelog are percent-encoded.
+type Description struct {
+	Version  string
+	Commit   string
+	Time     time.Time
+	Dirty    bool
+	Snapshot bool
+	// Operator is who released, RunURL is the CI job of the release
+	Operator  string
+	RunURL    string
+	Changelog string
+}
+
+// IsSnapshot reports whether the description belongs to a snapshot release,
+// descriptions without snapshot field are recognized by semver prerelease.
+func (d Description) IsSnapshot() bool {
+	if d.Snapshot {
+		return true
+	}
+	ver, err := semver.Parse(d.Version)
+	return err == nil && len(ver.Pre) > 0
+}
+
+func (d Description) String() string {
+	parts := []string{d.Version}
+	if d.Commit != "" {
+		parts = append(parts, "commit="+d.Commit)
+	}
+	if !d.Time.IsZero() {
+		parts = append(parts, "time="+d.Time.UTC().Format(time.RFC3339))
+	}
+	if d.Dirty {
+		parts = append(parts, "dirty=true")
+	}
+	if d.Snapshot {
+		parts = append(parts, "snapshot=true")
+	}
+	if d.Operator != "" {
+		parts = append(parts, "operator="+escape(d.Operator))
+	}
+	if d.RunURL != "" {
+		parts = append(parts, "run="+escape(d.RunURL))
+	}
+	s := strings.Join(parts, " ")
+	if d.Changelog == "" {
+		return s
+	}
+	// NOTE: changelog is truncated by runes, so that no escaped rune is cut in half
+	changelog := strings.TrimSpace(d.Changelog)
+	for len(changelog) > MaxLength {
+		_, size := utf8.DecodeLastRuneInString(changelog)
+		changelog = changelog[:len(changelog)-size]
+	}
+	for changelog != "" {
+		field := " changelog=" + escape(changelog)
+		if len(s)+len(field) <= MaxLength {
+			return s + field
+		}
+		_, size := utf8.DecodeLastRuneInString(changelog)
+		changelog = changelog[:len(changelog)-size]
+	}
+	return s
+}
+
+var escaper = strings.NewReplacer("%", "%25", " ", "%20", "\t", "%09", "\n", "%0A", "\r", "%0D")
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func unescape(s string) string {
+	if unescaped, err := url.PathUnescape(s); err == nil {
+		return unescaped
+	}
+	return s
+}
+
+func ParseDescription(s string) Description {
+	var d Description
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return d
+	}
+	d.Version = fields[0]
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "commit":
+			d.Commit = kv[1]
+		case "time":
+			d.Time, _ = time.Parse(time.RFC3339, kv[1])
+		case "dirty":
+			d.Dirty = kv[1] == "true"
+		case "snapshot":
+			d.Snapshot = kv[1] == "true"
+		case "operator":
+			d.Operator = unescape(kv[1])
+		case "run":
+			d.RunURL = unescape(kv[1])
+		case "changelog":
+			d.Changelog = unescape(kv[1])
+		}
+	}
+	return d
+}
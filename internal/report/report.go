@@ -0,0 +1,240 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+type Trigger struct {
+	Function  string `json:"function" yaml:"function"`
+	Name      string `json:"name" yaml:"name"`
+	Qualifier string `json:"qualifier,omitempty" yaml:"qualifier,omitempty"`
+}
+
+type Service struct {
+	Name string `json:"name" yaml:"name"`
+	// TemplateName is the name in template, may differ from Name if resolved by ROS
+	TemplateName    string    `json:"templateName,omitempty" yaml:"templateName,omitempty"`
+	VersionID       string    `json:"versionId,omitempty" yaml:"versionId,omitempty"`
+	Published       bool      `json:"published" yaml:"published"`
+	AliasCreated    bool      `json:"aliasCreated" yaml:"aliasCreated"`
+	CreatedTriggers []Trigger `json:"createdTriggers,omitempty" yaml:"createdTriggers,omitempty"`
+	DeletedTriggers []Trigger `json:"deletedTriggers,omitempty" yaml:"deletedTriggers,omitempty"`
+	DeletedAliases  []string  `json:"deletedAliases,omitempty" yaml:"deletedAliases,omitempty"`
+}
+
+type Route struct {
+	Path         string   `json:"path" yaml:"path"`
+	ServiceName  string   `json:"serviceName" yaml:"serviceName"`
+	FunctionName string   `json:"functionName" yaml:"functionName"`
+	Qualifier    string   `json:"qualifier,omitempty" yaml:"qualifier,omitempty"`
+	Methods      []string `json:"methods,omitempty" yaml:"methods,omitempty"`
+}
+
+type CustomDomain struct {
+	DomainName string   `json:"domainName" yaml:"domainName"`
+	Created    bool     `json:"created" yaml:"created"`
+	Before     []Route  `json:"before,omitempty" yaml:"before,omitempty"`
+	After      []Route  `json:"after,omitempty" yaml:"after,omitempty"`
+	Changes    []string `json:"changes,omitempty" yaml:"changes,omitempty"`
+}
+
+type Provision struct {
+	Service                string `json:"service" yaml:"service"`
+	Function               string `json:"function" yaml:"function"`
+	Qualifier              string `json:"qualifier" yaml:"qualifier"`
+	Target                 int64  `json:"target" yaml:"target"`
+	ScheduledActions       int    `json:"scheduledActions,omitempty" yaml:"scheduledActions,omitempty"`
+	TargetTrackingPolicies int    `json:"targetTrackingPolicies,omitempty" yaml:"targetTrackingPolicies,omitempty"`
+	Error                  string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Report is a structured record of a release, it is safe for concurrent use.
+type Report struct {
+	Stage         string          `json:"stage,omitempty" yaml:"stage,omitempty"`
+	Version       string          `json:"version" yaml:"version"`
+	Alias         string          `json:"alias" yaml:"alias"`
+	Commit        string          `json:"commit,omitempty" yaml:"commit,omitempty"`
+	Region        string          `json:"region,omitempty" yaml:"region,omitempty"`
+	Snapshot      bool            `json:"snapshot" yaml:"snapshot"`
+	DryRun        bool            `json:"dryRun" yaml:"dryRun"`
+	StartTime     time.Time       `json:"startTime" yaml:"startTime"`
+	Duration      string          `json:"duration,omitempty" yaml:"duration,omitempty"`
+	Services      []*Service      `json:"services" yaml:"services"`
+	CustomDomains []*CustomDomain `json:"customDomains,omitempty" yaml:"customDomains,omitempty"`
+	Provisions    []Provision     `json:"provisions,omitempty" yaml:"provisions,omitempty"`
+	Error         string          `json:"error,omitempty" yaml:"error,omitempty"`
+
+	mu sync.Mutex
+}
+
+// UpdateService calls f with service of name, which is added if not found.
+func (r *Report) UpdateService(name string, f func(s *Service)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.Services {
+		if s.Name == name {
+			f(s)
+			return
+		}
+	}
+	s := &Service{Name: name}
+	r.Services = append(r.Services, s)
+	f(s)
+}
+
+// UpdateCustomDomain calls f with custom domain of name, which is added if not found.
+func (r *Report) UpdateCustomDomain(name string, f func(d *CustomDomain)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.CustomDomains {
+		if d.DomainName == name {
+			f(d)
+			return
+		}
+	}
+	d := &CustomDomain{DomainName: name}
+	r.CustomDomains = append(r.CustomDomains, d)
+	f(d)
+}
+
+func (r *Report) AddProvision(p Provision) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Provisions = append(r.Provisions, p)
+}
+
+// Finish records duration and error of the release.
+func (r *Report) Finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Duration = time.Since(r.StartTime).Round(time.Millisecond).String()
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// FormatOf returns format of filename by its extension, json if unknown.
+func FormatOf(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yml", ".yaml":
+		return FormatYAML
+	default:
+		return FormatJSON
+	}
+}
+
+func (r *Report) Write(w io.Writer, format string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return write(w, format, r)
+}
+
+func (r *Report) WriteFile(filename string, format string) error {
+	return writeFile(filename, format, r)
+}
+
+// Combined is reports of a release to multiple regions.
+type Combined struct {
+	Regions []*Report `json:"regions" yaml:"regions"`
+}
+
+func (c *Combined) Write(w io.Writer, format string) error {
+	for _, r := range c.Regions {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+	}
+	return write(w, format, c)
+}
+
+func (c *Combined) WriteFile(filename string, format string) error {
+	return writeFile(filename, format, c)
+}
+
+type writer interface {
+	Write(w io.Writer, format string) error
+}
+
+func writeFile(filename string, format string, v writer) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = v.Write(f, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Encode writes v in format, e.g. for other outputs sharing formats of report.
+func Encode(w io.Writer, format string, v interface{}) error {
+	return write(w, format, v)
+}
+
+func write(w io.Writer, format string, v interface{}) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case FormatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("unknown report format %q, expect json or yaml", format)
+	}
+}
+
+// Changes describes changes recorded in report, one per line.
+func (r *Report) Changes() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var changes []string
+	for _, s := range r.Services {
+		if s.Published {
+			changes = append(changes, fmt.Sprintf("publish version of service %s", s.Name))
+		}
+		if s.AliasCreated {
+			changes = append(changes, fmt.Sprintf("create alias %s of service %s", r.Alias, s.Name))
+		}
+		for _, t := range s.DeletedTriggers {
+			changes = append(changes, fmt.Sprintf("delete trigger %s of %s/%s, qualifier [%s]", t.Name, s.Name, t.Function, t.Qualifier))
+		}
+		for _, t := range s.CreatedTriggers {
+			changes = append(changes, fmt.Sprintf("create trigger %s of %s/%s, qualifier [%s]", t.Name, s.Name, t.Function, t.Qualifier))
+		}
+		for _, a := range s.DeletedAliases {
+			changes = append(changes, fmt.Sprintf("delete alias %s of service %s", a, s.Name))
+		}
+	}
+	for _, d := range r.CustomDomains {
+		if d.Created {
+			changes = append(changes, fmt.Sprintf("create custom domain %s", d.DomainName))
+		}
+		for _, c := range d.Changes {
+			changes = append(changes, fmt.Sprintf("custom domain %s: %s", d.DomainName, c))
+		}
+	}
+	for _, p := range r.Provisions {
+		changes = append(changes, fmt.Sprintf("provision %s/%s.%s: target %d", p.Service, p.Function, p.Qualifier, p.Target))
+	}
+	return changes
+}
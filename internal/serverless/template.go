@@ -1,6 +1,10 @@
 package serverless
 
 import (
+	"fmt"
+
+	"github.com/wsw0108/aliyun-fc-releaser/internal/provision"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/smoke"
 	"gopkg.in/yaml.v3"
 )
 
@@ -35,6 +39,8 @@ type Function struct {
 	InstanceConcurrency  int
 	Timeout              int
 	EnvironmentVariables map[string]string
+	ProvisionConfig      *provision.Config
+	SmokeTests           []smoke.Check
 	Triggers             []Trigger
 }
 
@@ -48,10 +54,24 @@ type Service struct {
 	Functions      []Function
 }
 
+type RewriteRule struct {
+	Match       string
+	Replacement string
+}
+
+type RewriteConfig struct {
+	EqualRules    []RewriteRule
+	WildcardRules []RewriteRule
+	RegexRules    []RewriteRule
+}
+
 type PathConfig struct {
-	Path         string
-	ServiceName  string
-	FunctionName string
+	Path          string
+	ServiceName   string
+	FunctionName  string
+	Methods       []string
+	RewriteConfig *RewriteConfig
+	SmokeTests    []smoke.Check
 }
 
 type RouteConfig struct {
@@ -64,12 +84,24 @@ type CertConfig struct {
 	Certificate string
 }
 
+type TLSConfig struct {
+	MinVersion   string
+	MaxVersion   string
+	CipherSuites []string
+}
+
+type WAFConfig struct {
+	EnableWAF bool
+}
+
 type CustomDomain struct {
 	Name        string
 	DomainName  string
 	Protocol    string
 	RouteConfig RouteConfig
 	CertConfig  CertConfig
+	TLSConfig   TLSConfig
+	WAFConfig   *WAFConfig
 }
 
 type Template struct {
@@ -99,6 +131,8 @@ func convertFunction(name string, res function) (f Function) {
 	f.InstanceConcurrency = res.Properties.InstanceConcurrency
 	f.Timeout = res.Properties.Timeout
 	f.EnvironmentVariables = res.Properties.EnvironmentVariables
+	f.ProvisionConfig = res.Properties.ProvisionConfig
+	f.SmokeTests = res.Properties.SmokeTests
 	for tname, trigger := range res.Events {
 		t := convertTrigger(tname, trigger)
 		f.Triggers = append(f.Triggers, t)
@@ -120,6 +154,13 @@ func convertService(name string, res service) (s Service) {
 	return
 }
 
+func convertRewriteRules(res []rewriteRule) (rules []RewriteRule) {
+	for _, rule := range res {
+		rules = append(rules, RewriteRule(rule))
+	}
+	return
+}
+
 func convertCustomDomain(name string, res domain) (d CustomDomain) {
 	d.Name = name
 	d.DomainName = res.Properties.DomainName
@@ -127,11 +168,24 @@ func convertCustomDomain(name string, res domain) (d CustomDomain) {
 	d.CertConfig.CertName = res.Properties.CertConfig.CertName
 	d.CertConfig.Certificate = res.Properties.CertConfig.Certificate
 	d.CertConfig.PrivateKey = res.Properties.CertConfig.PrivateKey
+	d.TLSConfig = TLSConfig(res.Properties.TLSConfig)
+	if res.Properties.WAFConfig != nil {
+		d.WAFConfig = &WAFConfig{EnableWAF: res.Properties.WAFConfig.EnableWAF}
+	}
 	for path, route := range res.Properties.RouteConfig.Routes {
 		r := PathConfig{
 			Path:         path,
 			ServiceName:  route.ServiceName,
 			FunctionName: route.FunctionName,
+			Methods:      route.Methods,
+			SmokeTests:   route.SmokeTests,
+		}
+		if route.RewriteConfig != nil {
+			r.RewriteConfig = &RewriteConfig{
+				EqualRules:    convertRewriteRules(route.RewriteConfig.EqualRules),
+				WildcardRules: convertRewriteRules(route.RewriteConfig.WildcardRules),
+				RegexRules:    convertRewriteRules(route.RewriteConfig.RegexRules),
+			}
 		}
 		d.RouteConfig.Routes = append(d.RouteConfig.Routes, r)
 	}
@@ -157,3 +211,63 @@ func (t *Template) UnmarshalYAML(node *yaml.Node) error {
 	}
 	return nil
 }
+
+// LoadTemplate decodes template for region, mappings under "Regions.<region>" are merged
+// into the template, e.g. to use different domain names in each region:
+//
+//	Regions:
+//	  ap-southeast-1:
+//	    Resources:
+//	      my-domain:
+//	        Properties:
+//	          DomainName: sg.example.com
+func LoadTemplate(data []byte, region string) (*Template, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return &Template{}, nil
+	}
+	root := doc.Content[0]
+	if root.Kind == yaml.MappingNode {
+		if regions := mappingValue(root, "Regions"); regions != nil && region != "" {
+			if override := mappingValue(regions, region); override != nil {
+				if override.Kind != yaml.MappingNode {
+					return nil, fmt.Errorf("override of region %s is not a mapping", region)
+				}
+				mergeNode(root, override)
+			}
+		}
+	}
+	var t Template
+	if err := root.Decode(&t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mergeNode merges mapping src into dst recursively, other nodes of src replace those of dst.
+func mergeNode(dst *yaml.Node, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		existing := mappingValue(dst, key.Value)
+		switch {
+		case existing == nil:
+			dst.Content = append(dst.Content, key, value)
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			mergeNode(existing, value)
+		default:
+			*existing = *value
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package serverless
 
 import (
+	"github.com/wsw0108/aliyun-fc-releaser/internal/provision"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/smoke"
 	"gopkg.in/yaml.v3"
 )
 
@@ -69,6 +71,8 @@ type functionProperties struct {
 	InstanceConcurrency  int               `yaml:"InstanceConcurrency"`
 	Timeout              int               `yaml:"Timeout"`
 	EnvironmentVariables map[string]string `yaml:"EnvironmentVariables"`
+	ProvisionConfig      *provision.Config `yaml:"ProvisionConfig"`
+	SmokeTests           []smoke.Check     `yaml:"SmokeTests"`
 }
 
 type httpEventProperties struct {
@@ -108,7 +112,13 @@ type function struct {
 }
 
 type tlsConfig struct {
-	MinVersion string `yaml:"MinVersion"`
+	MinVersion   string   `yaml:"MinVersion"`
+	MaxVersion   string   `yaml:"MaxVersion"`
+	CipherSuites []string `yaml:"CipherSuites"`
+}
+
+type wafConfig struct {
+	EnableWAF bool `yaml:"EnableWAF"`
 }
 
 type certConfig struct {
@@ -117,9 +127,23 @@ type certConfig struct {
 	PrivateKey  string `yaml:"PrivateKey"`
 }
 
+type rewriteRule struct {
+	Match       string `yaml:"Match"`
+	Replacement string `yaml:"Replacement"`
+}
+
+type rewriteConfig struct {
+	EqualRules    []rewriteRule `yaml:"EqualRules"`
+	WildcardRules []rewriteRule `yaml:"WildcardRules"`
+	RegexRules    []rewriteRule `yaml:"RegexRules"`
+}
+
 type pathConfig struct {
-	ServiceName  string `yaml:"ServiceName"`
-	FunctionName string `yaml:"FunctionName"`
+	ServiceName   string         `yaml:"ServiceName"`
+	FunctionName  string         `yaml:"FunctionName"`
+	Methods       []string       `yaml:"Methods"`
+	RewriteConfig *rewriteConfig `yaml:"RewriteConfig"`
+	SmokeTests    []smoke.Check  `yaml:"SmokeTests"`
 }
 
 type routeConfig struct {
@@ -130,6 +154,7 @@ type domainProperties struct {
 	DomainName  string      `yaml:"DomainName"`
 	Protocol    string      `yaml:"Protocol"`
 	TLSConfig   tlsConfig   `yaml:"TLSConfig"`
+	WAFConfig   *wafConfig  `yaml:"WAFConfig"`
 	CertConfig  certConfig  `yaml:"CertConfig"`
 	RouteConfig routeConfig `yaml:"RouteConfig"`
 }
@@ -0,0 +1,150 @@
+package smoke
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Check is a HTTP request sent to the trigger of the new qualifier and its expectations.
+type Check struct {
+	Name    string            `yaml:"Name"`
+	Path    string            `yaml:"Path"`
+	Method  string            `yaml:"Method"`
+	Headers map[string]string `yaml:"Headers"`
+	Body    string            `yaml:"Body"`
+	// ExpectStatus defaults to 200
+	ExpectStatus int    `yaml:"ExpectStatus"`
+	ExpectBody   string `yaml:"ExpectBody"`
+	// ExpectJSON maps dot separated paths (e.g. data.items.0.id) to expected values
+	ExpectJSON map[string]interface{} `yaml:"ExpectJSON"`
+}
+
+func (c Check) String() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	method := c.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	return method + " " + c.Path
+}
+
+type Runner struct {
+	Client *http.Client
+}
+
+func NewRunner(timeout time.Duration) *Runner {
+	return &Runner{Client: &http.Client{Timeout: timeout}}
+}
+
+// Run sends check to baseURL and returns error if any expectation is not met.
+func (r *Runner) Run(baseURL string, check Check) error {
+	method := check.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	url := strings.TrimSuffix(baseURL, "/") + "/" + strings.TrimPrefix(check.Path, "/")
+	req, err := http.NewRequest(method, url, strings.NewReader(check.Body))
+	if err != nil {
+		return err
+	}
+	for k, v := range check.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	expectStatus := check.ExpectStatus
+	if expectStatus == 0 {
+		expectStatus = http.StatusOK
+	}
+	if resp.StatusCode != expectStatus {
+		return fmt.Errorf("expect status %d, got %d", expectStatus, resp.StatusCode)
+	}
+	if check.ExpectBody != "" {
+		re, err := regexp.Compile(check.ExpectBody)
+		if err != nil {
+			return err
+		}
+		if !re.Match(body) {
+			return fmt.Errorf("body does not match %q", check.ExpectBody)
+		}
+	}
+	if len(check.ExpectJSON) > 0 {
+		if err = MatchJSON(body, check.ExpectJSON); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MatchJSON checks values in json body, expect maps dot separated paths to expected values.
+func MatchJSON(body []byte, expect map[string]interface{}) error {
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return fmt.Errorf("body is not json: %w", err)
+	}
+	for path, expected := range expect {
+		actual, ok := lookup(decoded, path)
+		if !ok {
+			return fmt.Errorf("json path %s not found", path)
+		}
+		if !equal(actual, expected) {
+			return fmt.Errorf("json path %s: expect %v, got %v", path, expected, actual)
+		}
+	}
+	return nil
+}
+
+func lookup(v interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return v, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			child, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			v = child
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// equal compares decoded json with value from yaml, expected is normalized through json
+// so that numbers and nested values compare by value.
+func equal(actual interface{}, expected interface{}) bool {
+	data, err := json.Marshal(expected)
+	if err != nil {
+		return false
+	}
+	var normalized interface{}
+	if err = json.Unmarshal(data, &normalized); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(actual, normalized)
+}
@@ -0,0 +1,40 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Functions maps service names to names of their functions, e.g. those in template.
+type Functions map[string][]string
+
+// CheckRefs returns error if refs, function names keyed by service name, reference services
+// or functions not in fs, what names the source of refs in the error.
+func (fs Functions) CheckRefs(what string, refs map[string][]string) error {
+	var unknown []string
+	for serviceName, functionNames := range refs {
+		known, ok := fs[serviceName]
+		if !ok {
+			unknown = append(unknown, serviceName)
+			continue
+		}
+		for _, functionName := range functionNames {
+			found := false
+			for _, name := range known {
+				if name == functionName {
+					found = true
+					break
+				}
+			}
+			if !found {
+				unknown = append(unknown, serviceName+"/"+functionName)
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("%s references unknown services or functions: %s", what, strings.Join(unknown, ", "))
+	}
+	return nil
+}
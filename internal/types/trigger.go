@@ -1,7 +1,6 @@
 package types
 
 import (
-	"strings"
 	"time"
 )
 
@@ -14,6 +13,7 @@ const (
 type Trigger struct {
 	Name       string
 	Qualifier  string
+	Snapshot   bool
 	CreateTime time.Time
 	ModifyTime time.Time
 }
@@ -25,10 +25,11 @@ func (ts Triggers) Len() int {
 }
 
 func (ts Triggers) Less(i, j int) bool {
-	if strings.HasSuffix(ts[i].Qualifier, "-pre") && !strings.HasSuffix(ts[j].Qualifier, "-pre") {
+	// triggers of snapshot qualifiers are deleted first
+	if ts[i].Snapshot && !ts[j].Snapshot {
 		return true
 	}
-	if !strings.HasSuffix(ts[i].Qualifier, "-pre") && strings.HasSuffix(ts[j].Qualifier, "-pre") {
+	if !ts[i].Snapshot && ts[j].Snapshot {
 		return false
 	}
 	if ts[i].ModifyTime.Before(ts[j].ModifyTime) {
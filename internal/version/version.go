@@ -0,0 +1,174 @@
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver/v4"
+)
+
+const (
+	SchemeSemver = "semver"
+	SchemeCalver = "calver"
+	SchemeBuild  = "build"
+)
+
+var (
+	// YYYY.MM[.DD][.N], YY.MM[.DD][.N]
+	calverRegex = regexp.MustCompile(`^(\d{2}|\d{4})\.(\d{1,2})(\.\d+){0,2}$`)
+	// 1234, build-1234, r1234
+	buildRegex = regexp.MustCompile(`^([A-Za-z][A-Za-z_-]*)?(\d+)$`)
+)
+
+type Version struct {
+	Raw    string
+	Scheme string
+	Semver semver.Version
+	// numeric components of calver and build versions
+	Parts []uint64
+}
+
+func (v Version) String() string {
+	return v.Raw
+}
+
+func (v Version) Major() uint64 {
+	if v.Scheme == SchemeSemver {
+		return v.Semver.Major
+	}
+	return v.part(0)
+}
+
+func (v Version) Minor() uint64 {
+	if v.Scheme == SchemeSemver {
+		return v.Semver.Minor
+	}
+	return v.part(1)
+}
+
+func (v Version) Patch() uint64 {
+	if v.Scheme == SchemeSemver {
+		return v.Semver.Patch
+	}
+	return v.part(2)
+}
+
+func (v Version) part(i int) uint64 {
+	if i < len(v.Parts) {
+		return v.Parts[i]
+	}
+	return 0
+}
+
+func (v Version) Pre() string {
+	var pre []string
+	for _, p := range v.Semver.Pre {
+		pre = append(pre, p.String())
+	}
+	return strings.Join(pre, ".")
+}
+
+func (v Version) Build() string {
+	return strings.Join(v.Semver.Build, ".")
+}
+
+func (v Version) Prerelease() bool {
+	return v.Scheme == SchemeSemver && len(v.Semver.Pre) > 0
+}
+
+// Compare returns -1, 0 or 1, ok is false if versions of different schemes
+// can not be compared.
+func (v Version) Compare(o Version) (result int, ok bool) {
+	if v.Scheme != o.Scheme {
+		return 0, false
+	}
+	if v.Scheme == SchemeSemver {
+		return v.Semver.Compare(o.Semver), true
+	}
+	for i := 0; i < len(v.Parts) || i < len(o.Parts); i++ {
+		a, b := v.part(i), o.part(i)
+		if a < b {
+			return -1, true
+		}
+		if a > b {
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+type Policy struct {
+	Schemes []string
+}
+
+// ParsePolicy parses comma separated schemes, tried in order when parsing versions.
+func ParsePolicy(s string) (*Policy, error) {
+	p := &Policy{}
+	for _, scheme := range strings.Split(s, ",") {
+		scheme = strings.TrimSpace(scheme)
+		switch scheme {
+		case SchemeSemver, SchemeCalver, SchemeBuild:
+			p.Schemes = append(p.Schemes, scheme)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown version scheme %q, must be one of: %s, %s, %s", scheme, SchemeSemver, SchemeCalver, SchemeBuild)
+		}
+	}
+	if len(p.Schemes) == 0 {
+		return nil, fmt.Errorf("no version scheme specified")
+	}
+	return p, nil
+}
+
+// Parse parses version s, a leading 'v' is ignored.
+func (p *Policy) Parse(s string) (Version, error) {
+	raw := strings.TrimPrefix(s, "v")
+	var errs []string
+	for _, scheme := range p.Schemes {
+		v, err := parse(scheme, raw)
+		if err == nil {
+			return v, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", scheme, err))
+	}
+	return Version{}, fmt.Errorf("invalid release version %q (%s)", s, strings.Join(errs, "; "))
+}
+
+func parse(scheme string, raw string) (Version, error) {
+	v := Version{Raw: raw, Scheme: scheme}
+	switch scheme {
+	case SchemeSemver:
+		ver, err := semver.Parse(raw)
+		if err != nil {
+			return v, err
+		}
+		v.Semver = ver
+	case SchemeCalver:
+		if !calverRegex.MatchString(raw) {
+			return v, fmt.Errorf("expect YYYY.MM[.DD][.N]")
+		}
+		for _, s := range strings.Split(raw, ".") {
+			n, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return v, err
+			}
+			v.Parts = append(v.Parts, n)
+		}
+		if v.Parts[1] < 1 || v.Parts[1] > 12 {
+			return v, fmt.Errorf("invalid month %d", v.Parts[1])
+		}
+	case SchemeBuild:
+		matches := buildRegex.FindStringSubmatch(raw)
+		if matches == nil {
+			return v, fmt.Errorf("expect build number like 123 or build-123")
+		}
+		n, err := strconv.ParseUint(matches[2], 10, 64)
+		if err != nil {
+			return v, err
+		}
+		v.Parts = []uint64{n}
+	}
+	return v, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/wsw0108/aliyun-fc-releaser/internal/lock"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/logging"
+)
+
+// LockServices locks services of plan in order of name before any change is made, the returned
+// function releases the locks. In dry run mode locks are only checked.
+func LockServices(ctx *Context, plan *Plan) (func(), error) {
+	unlock := func() {}
+	if ctx.locker == nil {
+		return unlock, nil
+	}
+	names := make([]string, 0, len(plan.Services))
+	for _, service := range plan.Services {
+		names = append(names, service.Name)
+	}
+	sort.Strings(names)
+	if ctx.dryRun {
+		for _, name := range names {
+			info, _, ok, err := lock.Status(ctx.fcClient, name)
+			if err != nil {
+				return unlock, err
+			}
+			if ok && info.Owner != ctx.locker.Owner && !info.Expired(time.Now()) {
+				logging.Warn("Service is locked by another release", "step", "lock", "service", name, "owner", info.Owner, "version", info.Version, "expires", info.Expires)
+			}
+		}
+		return unlock, nil
+	}
+	var locked []string
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	unlock = func() {
+		// NOTE: renewal is stopped first, so that no lock is renewed after being released
+		close(stop)
+		<-done
+		for _, name := range locked {
+			if err := ctx.locker.Unlock(name); err != nil {
+				logging.Warn("Unlock failed", "step", "lock", "service", name, "error", err)
+				continue
+			}
+			logging.Debug("Unlocked", "step", "lock", "service", name)
+		}
+	}
+	for _, name := range names {
+		if err := ctx.locker.Lock(name, plan.Version.Raw); err != nil {
+			close(done)
+			unlock()
+			if errors.Is(err, lock.ErrNoVersion) {
+				err = fmt.Errorf("%w, release it without -lock for the first time", err)
+			}
+			return func() {}, err
+		}
+		logging.Info("Locked", "step", "lock", "service", name, "owner", ctx.locker.Owner, "ttl", ctx.locker.TTL)
+		locked = append(locked, name)
+	}
+	go renewLocks(ctx, locked, plan.Version.Raw, stop, done)
+	return unlock, nil
+}
+
+// renewLocks renews locks every third of TTL until stop is closed, so that locks of long
+// releases, e.g. waiting for provisioned instances, do not expire. Locks removed or taken over
+// meanwhile are recorded in ctx, so that the release is aborted before its next change.
+func renewLocks(ctx *Context, names []string, version string, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(ctx.locker.TTL / 3)
+	defer ticker.Stop()
+	for len(names) > 0 {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		held := names[:0:0]
+		for _, name := range names {
+			err := ctx.locker.Renew(name, version)
+			var locked *lock.LockedError
+			switch {
+			case err == nil:
+				logging.Debug("Lock renewed", "step", "lock", "service", name)
+			case errors.Is(err, lock.ErrRemoved) || errors.As(err, &locked):
+				logging.Error("Lock lost, release is aborted before next change", "step", "lock", "service", name, "error", err)
+				ctx.loseLock(err)
+				continue
+			default:
+				// NOTE: renewal is retried, the lock is kept until TTL elapsed
+				logging.Warn("Renew lock failed", "step", "lock", "service", name, "error", err)
+			}
+			held = append(held, name)
+		}
+		names = held
+	}
+	<-stop
+}
+
+// loseLock records why locks of the release are lost, only the first reason is kept.
+func (ctx *Context) loseLock(err error) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if ctx.lockLost == nil {
+		ctx.lockLost = err
+	}
+}
+
+// checkLock fails if locks of the release are lost, it is called before each change,
+// so that no change is made by releases not holding their locks.
+func (ctx *Context) checkLock() error {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if ctx.lockLost != nil {
+		return fmt.Errorf("release aborted: %w", ctx.lockLost)
+	}
+	return nil
+}
+
+// ForceUnlock removes release locks of services in template from regions of stages,
+// e.g. after a release crashed without releasing them.
+func ForceUnlock(stages []*Stage, templateData []byte) error {
+	var failed bool
+	for _, stage := range stages {
+		for _, region := range stage.Regions {
+			if err := forceUnlockRegion(stage, region, templateData); err != nil {
+				logging.Error("Force unlock failed", "stage", stage.Name, "region", region, "error", err)
+				failed = true
+			}
+		}
+	}
+	if failed {
+		return errors.New("force unlock failed")
+	}
+	return nil
+}
+
+func forceUnlockRegion(stage *Stage, region string, templateData []byte) error {
+	ctx, serviceNames, err := templateServices(stage, region, templateData)
+	if err != nil {
+		return err
+	}
+	for _, serviceName := range serviceNames {
+		info, ok, err := lock.ForceUnlock(ctx.fcClient, serviceName)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			logging.Info("Service is not locked", "region", region, "service", serviceName)
+			continue
+		}
+		logging.Info("Lock removed", "region", region, "service", serviceName, "owner", info.Owner, "version", info.Version, "expires", info.Expires)
+	}
+	return nil
+}
+
+// defaultLockOwner identifies the release by user, host and process, followed by job url for
+// runs of common CI systems. NOTE: job urls alone are not unique, e.g. parallel jobs of the same
+// GitHub workflow run or Jenkins stages share them, and locks of the same owner are renewed.
+func defaultLockOwner() string {
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s@%s:%d", currentUser(), host, os.Getpid())
+	if runURL := ciRunURL(); runURL != "" {
+		owner += " " + runURL
+	}
+	return owner
+}
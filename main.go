@@ -3,7 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -15,9 +15,19 @@ import (
 	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
 	ros "github.com/alibabacloud-go/ros-20190910/v4/client"
 	"github.com/aliyun/fc-go-sdk"
-	"github.com/blang/semver/v4"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/alias"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/fcapi"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/gitrepo"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/lock"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/logging"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/notify"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/provision"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/release"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/report"
 	"github.com/wsw0108/aliyun-fc-releaser/internal/serverless"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/smoke"
 	"github.com/wsw0108/aliyun-fc-releaser/internal/types"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/version"
 	"gopkg.in/yaml.v3"
 )
 
@@ -26,6 +36,67 @@ type Config struct {
 	RegionID        string `yaml:"region_id,omitempty"`
 	AccessKeyID     string `yaml:"access_key_id"`
 	AccessKeySecret string `yaml:"access_key_secret"`
+
+	// Regions to release to, endpoints of other regions are derived from Endpoint
+	// if not in Endpoints
+	Regions   []string          `yaml:"regions,omitempty"`
+	Endpoints map[string]string `yaml:"endpoints,omitempty"`
+
+	Notifiers []notify.Config `yaml:"notifiers,omitempty"`
+
+	// Protected requires confirmation of changes unless -yes is given
+	Protected bool `yaml:"protected,omitempty"`
+
+	// Profiles are credentials of other accounts used by pipeline stages, fields not
+	// set in a profile are inherited from the top level
+	Profiles map[string]*Config `yaml:"profiles,omitempty"`
+}
+
+func (c *Config) profile(name string) (*Config, error) {
+	if name == "" {
+		return c, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %s not found in config file", name)
+	}
+	merged := *p
+	if merged.Endpoint == "" && merged.AccessKeyID != "" {
+		// NOTE: endpoint contains id of the account
+		return nil, fmt.Errorf("endpoint of profile %s required", name)
+	}
+	if merged.Endpoint == "" {
+		merged.Endpoint = c.Endpoint
+	}
+	if merged.RegionID == "" && merged.Endpoint == c.Endpoint {
+		merged.RegionID = c.RegionID
+	}
+	if merged.AccessKeyID == "" {
+		merged.AccessKeyID = c.AccessKeyID
+		merged.AccessKeySecret = c.AccessKeySecret
+	}
+	return &merged, nil
+}
+
+func (c *Config) defaultRegions() []string {
+	if len(c.Regions) > 0 {
+		return c.Regions
+	}
+	if c.RegionID != "" {
+		return []string{c.RegionID}
+	}
+	return []string{extractRegion(c.Endpoint)}
+}
+
+func (c *Config) regionEndpoint(region string) string {
+	if endpoint, ok := c.Endpoints[region]; ok {
+		return endpoint
+	}
+	base := extractRegion(c.Endpoint)
+	if base == "" || region == "" || base == region {
+		return c.Endpoint
+	}
+	return strings.Replace(c.Endpoint, "."+base+".", "."+region+".", 1)
 }
 
 func loadConfig(configFile string) (*Config, error) {
@@ -51,19 +122,110 @@ func main() {
 		stackName      string
 		regionID       string
 		dryRun         bool
+		aliasTemplate  string
+		commit         string
+		force          bool
+		versionScheme  string
+		allowDowngrade bool
+		snapshotTTL    time.Duration
+		maxPrefixes    int
+		certWarning    time.Duration
+		provisionFile  string
+		handover       bool
+		handoverWait   time.Duration
+		smokeEndpoint  string
+		smokeTimeout   time.Duration
+		skipSmoke      bool
+		specFile       string
+		outputFormat   string
+		reportFile     string
+		verbose        bool
+		quiet          bool
+		logFormat      string
+		regionList     string
+		failFast       bool
+		pipelineFile   string
+		confirm        bool
+		assumeYes      bool
+		lockEnabled    bool
+		lockTTL        time.Duration
+		lockOwner      string
+		operator       string
+		runURL         string
+		changelog      string
 	)
 	home, err := os.UserHomeDir()
 	if err != nil {
-		log.Fatalln(err)
+		logging.Fatal(err.Error())
 	}
 	flag.StringVar(&configFile, "c", "", "config file contains credentials to release to fc")
 	flag.StringVar(&templateFile, "t", "template.yml", "template.yml to use")
-	flag.StringVar(&releaseVersion, "r", "", "release version")
-	flag.Int64Var(&instances, "instances", 0, "number of instances")
+	flag.StringVar(&releaseVersion, "r", "", "release version, default to the git tag pointing to HEAD")
+	flag.Int64Var(&instances, "instances", 0, "number of provisioned instances of functions without target in provision config")
+	flag.BoolVar(&handover, "provision-handover", false, "wait until provisioned instances of new alias are ready before removing those of old aliases, functions are waited for one by one up to -provision-timeout each")
+	flag.DurationVar(&handoverWait, "provision-timeout", 10*time.Minute, "max time to wait for provisioned instances of new alias")
+	flag.StringVar(&smokeEndpoint, "smoke-endpoint", "", "endpoint of HTTP triggers used by smoke tests, default to endpoint in config file")
+	flag.DurationVar(&smokeTimeout, "smoke-timeout", 10*time.Second, "timeout of each smoke test request")
+	flag.BoolVar(&skipSmoke, "skip-smoke", false, "do not run smoke tests before switching routes")
+	flag.StringVar(&specFile, "release-spec", "", "yaml file of release steps: invocation gates of functions and hooks")
+	flag.StringVar(&outputFormat, "output", "", "format of release report: json or yaml, report is written to stdout if -report is not set")
+	flag.StringVar(&reportFile, "report", "", "file to write release report to, format defaults to extension of the file")
+	flag.BoolVar(&verbose, "v", false, "verbose, log debug messages")
+	flag.BoolVar(&quiet, "q", false, "quiet, only log warnings and errors")
+	flag.StringVar(&logFormat, "log-format", logging.FormatText, "log format: text or json")
+	flag.StringVar(&provisionFile, "provision", "", "yaml file of provision configs or instance counts keyed by service and function name, overrides ProvisionConfig in template")
 	flag.StringVar(&stackName, "stack-name", "", "ros stack name")
 	flag.StringVar(&regionID, "region", "", "region name, default value will be extracted from endpoint")
+	flag.StringVar(&regionList, "regions", "", "comma separated regions to release to one by one, overrides -region, default to -region or regions in config file")
+	flag.BoolVar(&failFast, "fail-fast", false, "stop after the first region fails, instead of finishing other regions of the stage")
+	flag.StringVar(&pipelineFile, "pipeline", "", "yaml file of stages to release to in order, each with profile, regions, stack name and approval, overrides -regions and -stack-name")
+	flag.BoolVar(&confirm, "confirm", false, "show changes and ask for approval before applying them")
+	flag.BoolVar(&assumeYes, "yes", false, "approve changes without confirmation, also for protected environments and stages requiring approval")
+	flag.BoolVar(&lockEnabled, "lock", false, "lock services during release with a \"release-lock\" alias, so that concurrent releases of the same services fail, services need a published version")
+	flag.DurationVar(&lockTTL, "lock-ttl", time.Hour, "locks are renewed during release, locks not renewed within this duration, e.g. of crashed releases, can be taken over by other releases")
+	flag.StringVar(&lockOwner, "lock-owner", defaultLockOwner(), "owner of locks, unique to each release process, default to user@host:pid followed by url of CI job")
+	flag.StringVar(&operator, "operator", defaultOperator(), "who releases, recorded in descriptions of versions and aliases, default to CI user or current user")
+	flag.StringVar(&runURL, "run-url", ciRunURL(), "url of CI job of the release, recorded in descriptions of versions and aliases")
+	flag.StringVar(&changelog, "changelog", "", "changelog of the release recorded in descriptions of versions and aliases, truncated to fit")
 	flag.BoolVar(&dryRun, "dry-run", false, "do not perform real update")
-	flag.Parse()
+	flag.StringVar(&aliasTemplate, "alias-template", "", "go template of alias name, fields: Version, Major, Minor, Patch, Pre, Build, Commit, ShortCommit, Date, Time, Timestamp, default depends on version scheme")
+	flag.StringVar(&commit, "commit", "", "git commit SHA of the release, default to HEAD of the git repository")
+	flag.BoolVar(&force, "force", false, "release even if the git working tree is dirty")
+	flag.StringVar(&versionScheme, "version-scheme", version.SchemeSemver, "accepted schemes of release version, comma separated: semver, calver, build")
+	flag.BoolVar(&allowDowngrade, "allow-downgrade", false, "allow release version lower than the newest published one")
+	flag.DurationVar(&snapshotTTL, "snapshot-ttl", 0, "remove routes, triggers and aliases of snapshot releases older than this, 0 to keep them forever")
+	flag.DurationVar(&certWarning, "cert-expiry-warning", 30*24*time.Hour, "warn if certificate of custom domain expires within this duration")
+	flag.IntVar(&maxPrefixes, "max-snapshot-prefixes", 0, "max number of snapshot path prefixes kept on each custom domain, oldest are removed first, 0 for no limit")
+	flag.Usage = usage
+	// NOTE: the first argument is a command if it is not a flag
+	command := "release"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	if command != "release" && command != "force-unlock" && command != "history" {
+		usage()
+		os.Exit(2)
+	}
+	_ = flag.CommandLine.Parse(args)
+	if flag.NArg() > 0 {
+		// NOTE: a command after flags is refused, instead of running a release by mistake
+		fmt.Fprintf(flag.CommandLine.Output(), "unexpected argument %q, command must come before flags\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	logLevel := logging.LevelInfo
+	if verbose {
+		logLevel = logging.LevelDebug
+	} else if quiet {
+		logLevel = logging.LevelWarn
+	}
+	logger, err := logging.New(os.Stderr, logLevel, logFormat)
+	if err != nil {
+		logging.Fatal(err.Error())
+	}
+	logging.SetDefault(logger)
 
 	funConfigFile := filepath.Join(home, ".fcli", "config.yaml")
 	configFiles := []string{configFile, funConfigFile}
@@ -76,7 +238,7 @@ func main() {
 		}
 		decoded, err1 := loadConfig(filename)
 		if err1 != nil {
-			log.Println(err1)
+			logging.Warn("Read config file failed", "file", filename, "error", err1)
 			continue
 		}
 		config = decoded
@@ -84,180 +246,359 @@ func main() {
 		break
 	}
 	if config == nil {
-		log.Fatalln("can not read config file")
+		logging.Fatal("can not read config file")
 	}
-	log.Println("Using config file", useConfigFile)
+	logging.Info("Using config file", "file", useConfigFile)
 
+	// NOTE: region given by -region overrides regions in config file
+	explicitRegion := regionID != ""
 	if regionID == "" {
 		regionID = config.RegionID
 	}
 	if regionID == "" {
 		regionID = extractRegion(config.Endpoint)
 	}
-	if stackName != "" && regionID == "" {
-		log.Println("region required when using ros(-stack-name)")
-		os.Exit(-1)
+	var stages []*Stage
+	if pipelineFile != "" {
+		pipeline, err := loadPipeline(pipelineFile, config)
+		if err != nil {
+			logging.Fatal(err.Error())
+		}
+		stages = pipeline.Stages
+	} else {
+		stage := &Stage{StackName: stackName, config: config}
+		switch {
+		case regionList != "":
+			for _, region := range strings.Split(regionList, ",") {
+				if region = strings.TrimSpace(region); region != "" {
+					stage.Regions = append(stage.Regions, region)
+				}
+			}
+		case !explicitRegion && len(config.Regions) > 0:
+			stage.Regions = config.Regions
+		default:
+			stage.Regions = []string{regionID}
+		}
+		stages = append(stages, stage)
+	}
+	for _, stage := range stages {
+		for _, region := range stage.Regions {
+			if stage.StackName != "" && region == "" {
+				logging.Error("region required when using ros(-stack-name)", "stage", stage.Name)
+				os.Exit(-1)
+			}
+		}
+	}
+
+	if command != "release" {
+		templateData, err := os.ReadFile(templateFile)
+		if err != nil {
+			logging.Fatal(err.Error())
+		}
+		switch command {
+		case "force-unlock":
+			err = ForceUnlock(stages, templateData)
+		case "history":
+			err = History(stages, templateData, os.Stdout, outputFormat)
+		}
+		if err != nil {
+			logging.Fatal(err.Error())
+		}
+		return
+	}
+
+	if lockEnabled && lockTTL <= 0 {
+		logging.Fatal("positive -lock-ttl required", "lock_ttl", lockTTL)
+	}
+
+	// NOTE: git metadata is optional if -r and -commit are given, unreadable repositories
+	// are ignored then, e.g. of templates copied into a freshly initialized one
+	gitOptional := releaseVersion != "" && commit != ""
+	var dirty bool
+	if repo, err1 := gitrepo.Open(filepath.Dir(templateFile)); err1 != nil {
+		logging.Warn("Git repository not found", "error", err1)
+	} else {
+		if commit == "" {
+			if commit, err = repo.Head(); err != nil {
+				logging.Fatal(err.Error())
+			}
+		}
+		if releaseVersion == "" {
+			if releaseVersion, err = repo.VersionTag(); err != nil {
+				logging.Warn("Release version not found in git tags", "error", err)
+			} else {
+				logging.Info("Using release version from git tag", "version", releaseVersion)
+			}
+		}
+		dirtyFiles, err1 := repo.Dirty()
+		if err1 != nil {
+			if !gitOptional {
+				logging.Fatal(err1.Error())
+			}
+			logging.Warn("Git repository not readable, release without git metadata", "dir", repo.WorkDir, "error", err1)
+		}
+		if len(dirtyFiles) > 0 {
+			dirty = true
+			for _, filename := range dirtyFiles {
+				logging.Warn("Git working tree is dirty", "file", filename)
+			}
+			if !force {
+				logging.Error("refuse to release from a dirty working tree, use -force to release anyway")
+				os.Exit(-1)
+			}
+		}
 	}
 
 	if releaseVersion == "" {
-		log.Println("release version required")
+		logging.Error("release version required")
 		os.Exit(-1)
 	}
-	if releaseVersion[0] == 'v' {
-		releaseVersion = releaseVersion[1:]
+	versionPolicy, err := version.ParsePolicy(versionScheme)
+	if err != nil {
+		logging.Fatal(err.Error())
+	}
+	ver, err := versionPolicy.Parse(releaseVersion)
+	if err != nil {
+		logging.Fatal(err.Error())
 	}
+	releaseVersion = ver.Raw
 
-	var template serverless.Template
-	tf, err := os.Open(templateFile)
+	if aliasTemplate == "" {
+		aliasTemplate = alias.DefaultTemplates[ver.Scheme]
+	}
+	namer, err := alias.NewNamer(aliasTemplate)
 	if err != nil {
-		log.Fatalln(err)
+		logging.Fatal(err.Error())
 	}
-	defer tf.Close()
-	err = yaml.NewDecoder(tf).Decode(&template)
+
+	templateData, err := os.ReadFile(templateFile)
 	if err != nil {
-		log.Fatalln(err)
+		logging.Fatal(err.Error())
 	}
 
-	ctx := &Context{
-		dryRun:    dryRun,
-		stackName: stackName,
-		regionID:  regionID,
+	var provisionSpec *provision.Spec
+	if provisionFile != "" {
+		if provisionSpec, err = provision.LoadSpec(provisionFile); err != nil {
+			logging.Fatal(err.Error())
+		}
 	}
 
-	{
-		client, err := fc.NewClient(config.Endpoint, "2016-08-15", config.AccessKeyID, config.AccessKeySecret)
-		if err != nil {
-			log.Fatalln(err)
+	var releaseSpec *ReleaseSpec
+	if specFile != "" {
+		if releaseSpec, err = loadReleaseSpec(specFile); err != nil {
+			logging.Fatal(err.Error())
 		}
-		ctx.fcClient = client
 	}
 
-	if stackName != "" {
-		apiConfig := openapi.Config{}
-		apiConfig.SetAccessKeyId(config.AccessKeyID)
-		apiConfig.SetAccessKeySecret(config.AccessKeySecret)
-		client, err := ros.NewClient(&apiConfig)
+	if outputFormat == "" && reportFile != "" {
+		outputFormat = report.FormatOf(reportFile)
+	}
+	if outputFormat != "" && outputFormat != report.FormatJSON && outputFormat != report.FormatYAML {
+		logging.Fatal("unknown output format, expect json or yaml", "output", outputFormat)
+	}
+
+	var notifiers []notify.Notifier
+	for _, nc := range config.Notifiers {
+		notifier, err := notify.New(nc)
 		if err != nil {
-			log.Fatalln(err)
+			logging.Fatal(err.Error())
 		}
-		ctx.rosClient = client
+		notifiers = append(notifiers, notifier)
 	}
 
-	// NOTE: 1.2.3/v1.2.3 -> v1_2_3, （字母开头，字母数字下划线中划线）
-	ver := semver.MustParse(releaseVersion)
-	var aliasName string
-	aliasName = strings.ReplaceAll(releaseVersion, ".", "_")
-	if aliasName[0] != 'v' {
-		aliasName = "v" + aliasName
+	now := time.Now()
+	aliasData := alias.NewData(ver, commit, now)
+	aliasName, err := namer.Name(aliasData)
+	if err != nil {
+		logging.Fatal(err.Error())
 	}
-	if len(ver.Pre) > 0 {
-		aliasName = aliasName + "_" + time.Now().Format("2006_01_02")
-		ctx.snapshot = true
-		ctx.prevQualifier = fmt.Sprintf("v%d_%d_%d", ver.Major, ver.Minor, ver.Patch)
+	var prevQualifier string
+	if ver.Prerelease() {
+		prevQualifier, err = namer.Name(aliasData.Stable())
+		if err != nil {
+			logging.Fatal(err.Error())
+		}
 	}
+	logging.Info("Using alias", "alias", aliasName, "version", releaseVersion)
+	description := release.Description{
+		Version:  releaseVersion,
+		Commit:   commit,
+		Time:     now,
+		Dirty:    dirty,
+		Snapshot: ver.Prerelease(),
 
-	var services []serverless.Service
-	var customDomains []serverless.CustomDomain
+		Operator:  operator,
+		RunURL:    runURL,
+		Changelog: changelog,
+	}.String()
 
-	for _, service := range template.Services {
-		serviceName, err1 := ctx.GetServiceName(service.Name)
-		if err1 != nil {
-			log.Fatalln(err1)
+	// prepareRegion connects to region and prepares plan of template, changes are confirmed if required
+	prepareRegion := func(ctx *Context, plan *Plan, stage *Stage, region string) error {
+		config := stage.config
+		if err := ctx.connect(config, region); err != nil {
+			return err
+		}
+		if lockEnabled {
+			ctx.locker = lock.NewLocker(ctx.fcClient, lockOwner, lockTTL)
 		}
-		service.Name = serviceName
-		services = append(services, service)
-	}
 
-	req := fc.NewListCustomDomainsInput()
-	resp, err := ctx.fcClient.ListCustomDomains(req)
-	if err != nil {
-		log.Fatalln(err)
-	}
-	for _, customDomain := range template.CustomDomains {
-		cdc := customDomain
-		cdc.RouteConfig.Routes = make([]serverless.PathConfig, 0, len(customDomain.RouteConfig.Routes))
-		for _, route := range customDomain.RouteConfig.Routes {
-			serviceName, err1 := ctx.GetServiceName(route.ServiceName)
-			if err1 != nil {
-				log.Fatalln(err1)
-			}
-			route.ServiceName = serviceName
-			cdc.RouteConfig.Routes = append(cdc.RouteConfig.Routes, route)
-		}
-		domainName := customDomain.DomainName
-		if domainName == "Auto" {
-			for _, tplRoute := range cdc.RouteConfig.Routes {
-				serviceName := tplRoute.ServiceName
-				functionName := tplRoute.FunctionName
-				for _, cdr := range resp.CustomDomains {
-					if strings.HasSuffix(*cdr.DomainName, ".test.functioncompute.com") {
-						for _, route := range cdr.RouteConfig.Routes {
-							if *route.ServiceName == serviceName && *route.FunctionName == functionName {
-								domainName = *cdr.DomainName
-							}
-						}
-					}
-				}
+		template, err := serverless.LoadTemplate(templateData, region)
+		if err != nil {
+			return err
+		}
+		functions := make(types.Functions)
+		for _, service := range template.Services {
+			for _, function := range service.Functions {
+				functions[service.Name] = append(functions[service.Name], function.Name)
 			}
 		}
-		if domainName == "Auto" {
-			panic("can not handle 'DomainName: Auto'")
+		if err = provisionSpec.Check(functions); err != nil {
+			return err
 		}
-		cdc.DomainName = domainName
-		customDomains = append(customDomains, cdc)
-	}
-
-	for _, service := range services {
-		log.Printf("Publish version and alias for service %s", service.Name)
-		if _, err = PublishAndCreateAlias(ctx, service.Name, releaseVersion, aliasName); err != nil {
-			log.Fatalln(err)
+		if err = releaseSpec.Check(functions); err != nil {
+			return err
 		}
-		for _, function := range service.Functions {
-			log.Printf("Create HTTP Triggers for function %s", function.Name)
-			for _, trigger := range function.Triggers {
-				if trigger.Type != "HTTP" {
-					continue
-				}
-				if err = CreateHttpTrigger(ctx, service.Name, function.Name, trigger, releaseVersion, aliasName); err != nil {
-					log.Fatalln(err)
-				}
+		if err = PreparePlan(ctx, plan, template, filepath.Dir(templateFile), provisionSpec, instances); err != nil {
+			return err
+		}
+		if !dryRun && (confirm || stage.Approval || config.Protected) {
+			if assumeYes {
+				logging.Info("Changes approved by -yes")
+			} else if !isTerminal(os.Stdin) {
+				return fmt.Errorf("confirmation required but stdin is not a terminal, use -yes to approve")
+			} else if err = ConfirmRelease(ctx, plan, os.Stdin, os.Stderr); err != nil {
+				return err
 			}
 		}
+		return nil
 	}
-	for _, customDomain := range customDomains {
-		if err = UpdateCustomDomain(ctx, customDomain, aliasName); err != nil {
-			log.Fatalln(err)
+
+	releaseRegion := func(stage *Stage, region string) (*report.Report, error) {
+		config := stage.config
+		ctx := &Context{
+			dryRun:         dryRun,
+			stackName:      stage.StackName,
+			regionID:       region,
+			versionPolicy:  versionPolicy,
+			allowDowngrade: allowDowngrade,
+			snapshotTTL:    snapshotTTL,
+
+			maxSnapshotPrefixes: maxPrefixes,
+			certExpiryWarning:   certWarning,
+			provisionHandover:   handover,
+			provisionTimeout:    handoverWait,
+			smokeEndpoint:       smokeEndpoint,
+			smokeRunner:         smoke.NewRunner(smokeTimeout),
+			description:         description,
+			notifiers:           notifiers,
+			snapshot:            ver.Prerelease(),
+			prevQualifier:       prevQualifier,
+			report: &report.Report{
+				Stage:     stage.Name,
+				Version:   releaseVersion,
+				Alias:     aliasName,
+				Commit:    commit,
+				Region:    region,
+				Snapshot:  ver.Prerelease(),
+				DryRun:    dryRun,
+				StartTime: now,
+			},
+		}
+		if ctx.smokeEndpoint == "" {
+			ctx.smokeEndpoint = config.regionEndpoint(region)
+		}
+		plan := &Plan{
+			Version:   ver,
+			Commit:    commit,
+			AliasName: aliasName,
+			Spec:      releaseSpec,
+			SkipSmoke: skipSmoke,
+			StartTime: now,
+		}
+		// NOTE: failures before release are also reported to hooks and notifiers
+		if err := prepareRegion(ctx, plan, stage, region); err != nil {
+			FinishRelease(ctx, plan, err)
+			return ctx.report, err
+		}
+		return ctx.report, Release(ctx, plan)
+	}
+
+	baseLogger := logging.Default()
+	combined := &report.Combined{}
+	var failed []string
+stages:
+	for _, stage := range stages {
+		lg := baseLogger
+		if stage.Name != "" {
+			lg = lg.With("stage", stage.Name)
+		}
+		for _, region := range stage.Regions {
+			if len(stage.Regions) > 1 || len(stages) > 1 {
+				logging.SetDefault(lg.With("region", region))
+			}
+			logging.Info("Release to region", "region", region)
+			r, err := releaseRegion(stage, region)
+			combined.Regions = append(combined.Regions, r)
+			if err == nil {
+				continue
+			}
+			logging.Error("Release failed", "region", region, "error", err)
+			failed = append(failed, strings.TrimPrefix(stage.Name+"/"+region, "/"))
+			if failFast {
+				break stages
+			}
+		}
+		// NOTE: a failed stage is never promoted to the next one
+		if len(failed) > 0 {
+			break
 		}
 	}
-	if !ctx.snapshot && instances > 0 {
-		for _, service := range services {
-			for _, function := range service.Functions {
-				if err = CreateProvisionConfig(ctx, service.Name, aliasName, function.Name, instances); err != nil {
-					log.Fatalln(err)
-				}
-			}
+	logging.SetDefault(baseLogger)
+	if outputFormat != "" {
+		var w interface {
+			Write(w io.Writer, format string) error
+			WriteFile(filename string, format string) error
+		} = combined
+		// NOTE: format depends on configured regions, not those released before a failure
+		var configured int
+		for _, stage := range stages {
+			configured += len(stage.Regions)
 		}
+		if configured == 1 && len(combined.Regions) == 1 {
+			w = combined.Regions[0]
+		}
+		if reportFile != "" {
+			err = w.WriteFile(reportFile, outputFormat)
+		} else {
+			err = w.Write(os.Stdout, outputFormat)
+		}
+		if err != nil {
+			logging.Error("Write report failed", "error", err)
+		}
+	}
+	if len(failed) > 0 {
+		logging.Fatal("Release failed", "regions", failed)
 	}
 }
 
 func PublishAndCreateAlias(ctx *Context, serviceName string, releaseVersion string, aliasName string) (string, error) {
+	lg := logging.With("step", "publish", "service", serviceName, "qualifier", aliasName, "version", releaseVersion)
 	listServiceVersionsInput := fc.NewListServiceVersionsInput(serviceName)
 	published := false
 	var publishedVersionID string
 	{
-		resp, err := ctx.fcClient.ListServiceVersions(listServiceVersionsInput)
+		resp, err := fcapi.ListAllServiceVersions(ctx.fcClient, listServiceVersionsInput)
 		if err != nil {
 			return "", err
 		}
-		log.Println("Existing versions:")
 		for _, vm := range resp.Versions {
-			log.Printf("  id: %s, description: %s", *vm.VersionID, *vm.Description)
+			lg.Debug("Existing version", "version_id", stringValue(vm.VersionID), "description", stringValue(vm.Description))
 		}
 		for _, vm := range resp.Versions {
 			if vm.Description == nil {
 				continue
 			}
-			if *vm.Description == releaseVersion {
+			if release.ParseDescription(*vm.Description).Version == releaseVersion {
 				published = true
 				publishedVersionID = *vm.VersionID
 				break
@@ -265,21 +606,20 @@ func PublishAndCreateAlias(ctx *Context, serviceName string, releaseVersion stri
 		}
 	}
 	if published {
-		log.Printf("Version %s[%s] for service %s already published", releaseVersion, publishedVersionID, serviceName)
+		lg.Info("Version already published", "version_id", publishedVersionID)
 	} else {
-		log.Printf("Version %s for service %s will be published", releaseVersion, serviceName)
+		lg.Info("Version will be published")
 	}
 	listAliasInput := fc.NewListAliasesInput(serviceName)
 	aliasExists := false
 	var aliasVersionID string
 	{
-		resp, err := ctx.fcClient.ListAliases(listAliasInput)
+		resp, err := fcapi.ListAllAliases(ctx.fcClient, listAliasInput)
 		if err != nil {
 			return "", err
 		}
-		log.Println("Existing alias:")
 		for _, am := range resp.Aliases {
-			log.Printf("  name: %s, id: %s, description: %s", *am.AliasName, *am.VersionID, *am.Description)
+			lg.Debug("Existing alias", "qualifier", stringValue(am.AliasName), "version_id", stringValue(am.VersionID), "description", stringValue(am.Description))
 		}
 		for _, am := range resp.Aliases {
 			if am.AliasName == nil {
@@ -293,28 +633,36 @@ func PublishAndCreateAlias(ctx *Context, serviceName string, releaseVersion stri
 		}
 	}
 	if aliasExists {
-		log.Printf("Alias %s for version %s[%s] of service %s already exists", aliasName, releaseVersion, aliasVersionID, serviceName)
+		lg.Info("Alias already exists", "version_id", aliasVersionID)
 	} else {
-		log.Printf("Alias %s for version %s of service %s will be created", aliasName, releaseVersion, serviceName)
+		lg.Info("Alias will be created")
 	}
+	ctx.report.UpdateService(serviceName, func(s *report.Service) {
+		s.VersionID = publishedVersionID
+		s.Published = !published
+		s.AliasCreated = !aliasExists
+	})
 	if ctx.dryRun {
 		return "", nil
 	}
 	if !published {
 		publishServiceVersionInput := fc.NewPublishServiceVersionInput(serviceName)
-		publishServiceVersionInput.WithDescription(releaseVersion)
+		publishServiceVersionInput.WithDescription(ctx.description)
 		publishServiceVersionOutput, err := ctx.fcClient.PublishServiceVersion(publishServiceVersionInput)
 		// NOTE: "can not publish version for service 'xxx', detail: 'No changes were made since last publish'"
 		if err != nil {
 			return "", err
 		}
 		publishedVersionID = *publishServiceVersionOutput.VersionID
+		ctx.report.UpdateService(serviceName, func(s *report.Service) {
+			s.VersionID = publishedVersionID
+		})
 	}
 	if !aliasExists {
 		createAliasInput := fc.NewCreateAliasInput(serviceName)
 		createAliasInput.WithVersionID(publishedVersionID)
 		createAliasInput.WithAliasName(aliasName)
-		createAliasInput.WithDescription(releaseVersion)
+		createAliasInput.WithDescription(ctx.description)
 		_, err := ctx.fcClient.CreateAlias(createAliasInput)
 		if err != nil {
 			return "", err
@@ -324,13 +672,58 @@ func PublishAndCreateAlias(ctx *Context, serviceName string, releaseVersion stri
 	return publishedVersionID, nil
 }
 
-func CreateHttpTrigger(ctx *Context, serviceName string, functionName string, trigger serverless.Trigger, releaseVersion string, qualifier string) error {
+func CheckDowngrade(ctx *Context, serviceName string, ver version.Version) error {
+	listServiceVersionsInput := fc.NewListServiceVersionsInput(serviceName)
+	resp, err := fcapi.ListAllServiceVersions(ctx.fcClient, listServiceVersionsInput)
+	if err != nil {
+		return err
+	}
+	var newest *version.Version
+	for _, vm := range resp.Versions {
+		if vm.Description == nil {
+			continue
+		}
+		published, err := ctx.versionPolicy.Parse(release.ParseDescription(*vm.Description).Version)
+		if err != nil || published.Prerelease() {
+			continue
+		}
+		if newest == nil {
+			newest = &published
+			continue
+		}
+		if c, ok := published.Compare(*newest); ok && c > 0 {
+			newest = &published
+		}
+	}
+	if newest == nil {
+		return nil
+	}
+	if c, ok := ver.Compare(*newest); ok && c < 0 {
+		if ctx.allowDowngrade {
+			logging.Warn("Version is lower than published version, downgrade allowed", "service", serviceName, "version", ver, "published", newest)
+			return nil
+		}
+		return fmt.Errorf("version %s is lower than published version %s of service %s, use -allow-downgrade to release anyway", ver, newest, serviceName)
+	}
+	return nil
+}
+
+func CreateHttpTrigger(ctx *Context, serviceName string, functionName string, trigger serverless.Trigger, qualifier string) error {
+	lg := logging.With("step", "trigger", "service", serviceName, "function", functionName, "qualifier", qualifier)
 	triggerName := fmt.Sprintf("%s-%s", trigger.Name, qualifier)
 	listTriggerInput := fc.NewListTriggersInput(serviceName, functionName)
-	listTriggerOutput, err := ctx.fcClient.ListTriggers(listTriggerInput)
+	listTriggerOutput, err := fcapi.ListAllTriggers(ctx.fcClient, listTriggerInput)
 	if err != nil {
 		return err
 	}
+	snapshots, err := ListSnapshots(ctx, serviceName)
+	if err != nil {
+		return err
+	}
+	snapshotAliases := make(map[string]bool)
+	for _, snapshot := range snapshots {
+		snapshotAliases[snapshot.AliasName] = true
+	}
 	triggerExists := false
 	var triggers types.Triggers
 	for _, tm := range listTriggerOutput.Triggers {
@@ -346,23 +739,22 @@ func CreateHttpTrigger(ctx *Context, serviceName string, functionName string, tr
 		}
 		if tm.Qualifier != nil {
 			tt.Qualifier = *tm.Qualifier
+			tt.Snapshot = snapshotAliases[tt.Qualifier]
 		}
 		triggers = append(triggers, tt)
 	}
 	sort.Sort(triggers)
-	log.Printf("Existing Triggers:")
 	for _, tm := range triggers {
-		log.Printf("  name: %s, qualifier [%s]", tm.Name, tm.Qualifier)
+		lg.Debug("Existing trigger", "trigger", tm.Name, "trigger_qualifier", tm.Qualifier)
 	}
 	if triggerExists {
-		log.Printf("Trigger %s already exists", triggerName)
+		lg.Info("Trigger already exists", "trigger", triggerName)
 		return nil
 	}
 	if len(triggers) >= types.MaxTriggers {
 		triggersToDelete := triggers[:(len(triggers) - (types.MaxTriggers - 1))]
-		log.Printf("Triggers to delete:")
 		for _, td := range triggersToDelete {
-			log.Printf("  name %s, qualifier [%s]", td.Name, td.Qualifier)
+			lg.Info("Delete trigger", "trigger", td.Name, "trigger_qualifier", td.Qualifier)
 			if !ctx.dryRun {
 				deleteTriggerInput := fc.NewDeleteTriggerInput(serviceName, functionName, td.Name)
 				_, err = ctx.fcClient.DeleteTrigger(deleteTriggerInput)
@@ -370,13 +762,19 @@ func CreateHttpTrigger(ctx *Context, serviceName string, functionName string, tr
 			if err != nil {
 				return err
 			}
+			deleted := report.Trigger{Function: functionName, Name: td.Name, Qualifier: td.Qualifier}
+			ctx.report.UpdateService(serviceName, func(s *report.Service) {
+				s.DeletedTriggers = append(s.DeletedTriggers, deleted)
+			})
 			if td.Qualifier != "" && td.Qualifier != "LATEST" {
 				// TODO: remove resources(route/alias/version) related to qualifier?
 			}
 		}
 	}
-	log.Printf("Create Trigger:")
-	log.Printf("  name %s, qualifier [%s]", triggerName, qualifier)
+	lg.Info("Create trigger", "trigger", triggerName)
+	ctx.report.UpdateService(serviceName, func(s *report.Service) {
+		s.CreatedTriggers = append(s.CreatedTriggers, report.Trigger{Function: functionName, Name: triggerName, Qualifier: qualifier})
+	})
 	if ctx.dryRun {
 		return nil
 	}
@@ -389,181 +787,87 @@ func CreateHttpTrigger(ctx *Context, serviceName string, functionName string, tr
 	triggerConfig.WithAuthType(strings.ToLower(trigger.HTTP.AuthType))
 	triggerConfig.WithMethods(trigger.HTTP.Methods...)
 	createTriggerInput.WithTriggerConfig(triggerConfig)
-	createTriggerInput.WithDescription(releaseVersion)
+	createTriggerInput.WithDescription(ctx.description)
 	_, err = ctx.fcClient.CreateTrigger(createTriggerInput)
 	// TODO: 同时创建相应的ROS资源？
 	return err
 }
 
-func UpdateCustomDomain(ctx *Context, customDomain serverless.CustomDomain, qualifier string) error {
-	listCustomDomainInput := fc.NewListCustomDomainsInput()
-	listCustomDomainOutput, err := ctx.fcClient.ListCustomDomains(listCustomDomainInput)
-	var routeConfigToUpdate *fc.RouteConfig
-	for _, d := range listCustomDomainOutput.CustomDomains {
-		if *d.DomainName == customDomain.DomainName {
-			routeConfigToUpdate = d.RouteConfig
-			break
-		}
-	}
-	if routeConfigToUpdate == nil {
-		log.Printf("Name of Custom Domain to create: %s", customDomain.DomainName)
-		createCustomDomainInput := fc.NewCreateCustomDomainInput()
-		createCustomDomainInput.DomainName = &customDomain.DomainName
-		createCustomDomainInput.Protocol = &customDomain.Protocol
-		routeConfig := fc.NewRouteConfig()
-		for _, route := range customDomain.RouteConfig.Routes {
-			newRoute := fc.PathConfig{}
-			newRoute.Path = &route.Path
-			newRoute.ServiceName = &route.ServiceName
-			newRoute.FunctionName = &route.FunctionName
-			newRoute.Qualifier = &qualifier
-			// newRoute.Methods = route.Methods
-			routeConfig.Routes = append(routeConfig.Routes, newRoute)
-		}
-		createCustomDomainInput.RouteConfig = routeConfig
-		certConfig := fc.CertConfig{}
-		certConfig.CertName = &customDomain.CertConfig.CertName
-		certConfig.Certificate = &customDomain.CertConfig.Certificate
-		certConfig.PrivateKey = &customDomain.CertConfig.PrivateKey
-		createCustomDomainInput.CertConfig = &certConfig
-		log.Printf("Routes of Custom Domain:")
-		for _, route := range routeConfig.Routes {
-			if route.Qualifier != nil {
-				log.Printf("  service %s, function %s, path %s, qualifier [%s]", *route.ServiceName, *route.FunctionName, *route.Path, *route.Qualifier)
-			} else {
-				log.Printf("  service %s, function %s, path %s, qualifier [%s]", *route.ServiceName, *route.FunctionName, *route.Path, "")
-			}
-		}
-		if !ctx.dryRun {
-			_, err = ctx.fcClient.CreateCustomDomain(createCustomDomainInput)
-		}
-		return err
-	}
-	updateCustomDomainInput := fc.NewUpdateCustomDomainInput(customDomain.DomainName)
-	updateCustomDomainInput.WithProtocol(customDomain.Protocol)
-	routeConfig := fc.NewRouteConfig()
-	// TODO: 最多只保留固定数量的Routes（依限制而定）
-	for _, route := range routeConfigToUpdate.Routes {
-		// 非ROS，fun deploy直接用template中的覆盖
-		// ROS，fun deploy不改变路由设置
-		if ctx.snapshot {
-			// FIXME: prevQualifier不存在的话不需要加（能够添加）
-			// route.WithQualifier(ctx.prevQualifier)
-		} else {
-			for _, froute := range customDomain.RouteConfig.Routes {
-				if *route.Path == froute.Path && *route.ServiceName == froute.ServiceName && *route.FunctionName == froute.FunctionName {
-					route.WithQualifier(qualifier)
-					break
-				}
-			}
-		}
-		routeConfig.Routes = append(routeConfig.Routes, route)
-	}
-	routeExistsInConfig := func(routeConfig *fc.RouteConfig, route *fc.PathConfig) bool {
-		for _, r := range routeConfig.Routes {
-			if *r.ServiceName == *route.ServiceName && *r.FunctionName == *route.FunctionName && *r.Path == *route.Path && *r.Qualifier == *route.Qualifier {
-				return true
-			}
-		}
-		return false
-	}
-	if ctx.snapshot {
-		for _, route := range customDomain.RouteConfig.Routes {
-			newRoute := fc.PathConfig{}
-			prefix := "/" + qualifier
-			path := prefix + route.Path
-			newRoute.Path = &path
-			newRoute.ServiceName = &route.ServiceName
-			newRoute.FunctionName = &route.FunctionName
-			newRoute.Qualifier = &qualifier
-			// newRoute.Methods = route.Methods
-			if !routeExistsInConfig(routeConfig, &newRoute) {
-				routeConfig.Routes = append(routeConfig.Routes, newRoute)
-			}
-		}
-	}
-	updateCustomDomainInput.WithRouteConfig(routeConfig)
-	log.Printf("Name of Custom Domain to update: %s", customDomain.DomainName)
-	log.Printf("Routes of Custom Domain to update:")
-	for _, route := range routeConfig.Routes {
-		if route.Qualifier != nil {
-			log.Printf("  service %s, function %s, path %s, qualifier [%s]", *route.ServiceName, *route.FunctionName, *route.Path, *route.Qualifier)
-		} else {
-			log.Printf("  service %s, function %s, path %s, qualifier [%s]", *route.ServiceName, *route.FunctionName, *route.Path, "")
-		}
-	}
-	if !ctx.dryRun {
-		_, err = ctx.fcClient.UpdateCustomDomain(updateCustomDomainInput)
-	}
-	return err
-}
-
-func CreateProvisionConfig(ctx *Context, serviceName string, qualifier string, functionName string, targetInstances int64) error {
-	listProvisionConfigsInput := fc.NewListProvisionConfigsInput()
-	listProvisionConfigsOutput, err := ctx.fcClient.ListProvisionConfigs(listProvisionConfigsInput)
-	if err != nil {
-		return err
-	}
-	resourcePattern := fmt.Sprintf("^.*#%s#(.+)#%s$", serviceName, functionName)
-	resourceRegex := regexp.MustCompile(resourcePattern)
-	var qualifiers []string
+type Context struct {
+	dryRun      bool
+	description string
 
-	for _, pc := range listProvisionConfigsOutput.ProvisionConfigs {
-		if pc.Resource == nil || pc.Current == nil || pc.Target == nil {
-			continue
-		}
-		if *pc.Current == 0 && *pc.Target == 0 {
-			continue
-		}
-		matches := resourceRegex.FindStringSubmatch(*pc.Resource)
-		if len(matches) < 2 {
-			continue
-		}
-		qualifiers = append(qualifiers, matches[1])
-	}
-	if ctx.dryRun {
-		log.Println("Existing provision configs:")
-		for _, pc := range listProvisionConfigsOutput.ProvisionConfigs {
-			fmt.Println(*pc)
-		}
-		log.Println("Qualifiers to update:")
-		for _, s := range qualifiers {
-			fmt.Println(s)
-		}
-		return nil
-	}
-	putProvisionConfigInput := fc.NewPutProvisionConfigInput(serviceName, qualifier, functionName)
-	putProvisionConfigInput.WithTarget(targetInstances)
-	_, err = ctx.fcClient.PutProvisionConfig(putProvisionConfigInput)
-	if err != nil {
-		return err
-	}
-	// TODO: 同时创建相应ROS资源
-	if len(qualifiers) > 0 {
-		for _, qualifierToUpdate := range qualifiers {
-			updateProvisionConfigInput := fc.NewPutProvisionConfigInput(serviceName, qualifierToUpdate, functionName)
-			updateProvisionConfigInput.WithTarget(0)
-			// ignore error
-			_, _ = ctx.fcClient.PutProvisionConfig(updateProvisionConfigInput)
-		}
-	}
-	return nil
-}
+	versionPolicy  *version.Policy
+	allowDowngrade bool
+	snapshotTTL    time.Duration
 
-type Context struct {
-	dryRun bool
+	maxSnapshotPrefixes int
+	certExpiryWarning   time.Duration
+	provisionHandover   bool
+	provisionTimeout    time.Duration
+	smokeEndpoint       string
+	smokeRunner         *smoke.Runner
 
 	stackName string
 	regionID  string
 
 	fcClient  *fc.Client
+	apiClient *fcapi.Client
 	rosClient *ros.Client
 
 	snapshot      bool
 	prevQualifier string
+	baselines     map[string]string
 
-	mu      sync.Mutex
-	stackID string
+	notifiers []notify.Notifier
+	report    *report.Report
+	locker    *lock.Locker
+
+	mu       sync.Mutex
+	stackID  string
+	lockLost error
+}
+
+// connect creates clients of fc and ros for region with credentials of config.
+func (ctx *Context) connect(config *Config, region string) error {
+	client, err := fc.NewClient(config.regionEndpoint(region), "2016-08-15", config.AccessKeyID, config.AccessKeySecret)
+	if err != nil {
+		return err
+	}
+	ctx.fcClient = client
+	ctx.apiClient = fcapi.NewClient(client)
+	if ctx.stackName != "" {
+		apiConfig := openapi.Config{}
+		apiConfig.SetAccessKeyId(config.AccessKeyID)
+		apiConfig.SetAccessKeySecret(config.AccessKeySecret)
+		apiConfig.SetRegionId(region)
+		ctx.rosClient, err = ros.NewClient(&apiConfig)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// templateServices connects to region of stage and resolves names of services in template.
+func templateServices(stage *Stage, region string, templateData []byte) (*Context, []string, error) {
+	ctx := &Context{stackName: stage.StackName, regionID: region}
+	if err := ctx.connect(stage.config, region); err != nil {
+		return nil, nil, err
+	}
+	template, err := serverless.LoadTemplate(templateData, region)
+	if err != nil {
+		return nil, nil, err
+	}
+	var serviceNames []string
+	for _, service := range template.Services {
+		serviceName, err := ctx.GetServiceName(service.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		serviceNames = append(serviceNames, serviceName)
+	}
+	return ctx, serviceNames, nil
 }
 
 func (ctx *Context) getStackID() (string, error) {
@@ -653,6 +957,25 @@ type GetStackResourceResponse struct {
 	ResourceDriftStatus string
 }
 
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [command] [flags]\n\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(out, "Commands, given before flags:")
+	fmt.Fprintln(out, "  release       release version to fc (default)")
+	fmt.Fprintln(out, "  force-unlock  remove release locks of services in template, e.g. left by crashed releases")
+	fmt.Fprintln(out, "  history       list releases of services in template, newest first, -output for json or yaml")
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// stringValue dereferences optional string fields of fc responses, e.g. to log them.
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
 func extractRegion(endpoint string) string {
 	re := "^https?:\\/\\/[^.]+\\.([^.]+)\\..+$"
 	regex, err := regexp.Compile(re)
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Stage is a step of a pipeline, the same version is released to stages in order.
+type Stage struct {
+	Name string `yaml:"Name"`
+	// Profile is name of profile in config file, empty to use the top level credentials
+	Profile   string   `yaml:"Profile"`
+	Regions   []string `yaml:"Regions"`
+	StackName string   `yaml:"StackName"`
+	// Approval requires confirmation of changes before releasing to the stage
+	Approval bool `yaml:"Approval"`
+
+	config *Config
+}
+
+// Pipeline is a list of stages, e.g. staging and production in different accounts:
+//
+//	Stages:
+//	  - Name: staging
+//	    Profile: staging
+//	    Regions: [cn-hangzhou]
+//	  - Name: production
+//	    Profile: production
+//	    Regions: [cn-hangzhou, cn-shanghai]
+//	    Approval: true
+type Pipeline struct {
+	Stages []*Stage `yaml:"Stages"`
+}
+
+func loadPipeline(filename string, config *Config) (*Pipeline, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var decoded Pipeline
+	err = yaml.NewDecoder(f).Decode(&decoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded.Stages) == 0 {
+		return nil, fmt.Errorf("no stages in pipeline %s", filename)
+	}
+	names := make(map[string]bool)
+	for i, stage := range decoded.Stages {
+		if stage.Name == "" {
+			stage.Name = fmt.Sprintf("stage-%d", i+1)
+		}
+		if names[stage.Name] {
+			return nil, fmt.Errorf("duplicate stage %s in pipeline %s", stage.Name, filename)
+		}
+		names[stage.Name] = true
+		if stage.config, err = config.profile(stage.Profile); err != nil {
+			return nil, fmt.Errorf("stage %s: %w", stage.Name, err)
+		}
+		if len(stage.Regions) == 0 {
+			stage.Regions = stage.config.defaultRegions()
+		}
+	}
+	return &decoded, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aliyun/fc-go-sdk"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/fcapi"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/logging"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/provision"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/report"
+)
+
+// ResolveProvisionConfig returns provision config of function, the sidecar spec takes
+// precedence over template, defaultTarget is used if neither specifies a target.
+func ResolveProvisionConfig(spec *provision.Spec, serviceName string, functionName string, templateConfig *provision.Config, defaultTarget int64) (*provision.Config, error) {
+	config := templateConfig
+	if c := spec.Get(serviceName, functionName); c != nil {
+		config = c
+	}
+	if config == nil {
+		if defaultTarget <= 0 {
+			return nil, nil
+		}
+		config = &provision.Config{}
+	}
+	resolved := *config
+	if resolved.Target == nil {
+		target := defaultTarget
+		if target < 0 {
+			target = 0
+		}
+		resolved.Target = &target
+	}
+	if err := resolved.Validate(); err != nil {
+		return nil, fmt.Errorf("provision config of %s/%s: %w", serviceName, functionName, err)
+	}
+	return &resolved, nil
+}
+
+const provisionPollInterval = 10 * time.Second
+
+func newProvisionConfig(config *provision.Config) *fcapi.ProvisionConfig {
+	pc := &fcapi.ProvisionConfig{}
+	if config.Target != nil {
+		pc.Target = *config.Target
+	}
+	for _, action := range config.ScheduledActions {
+		pc.ScheduledActions = append(pc.ScheduledActions, fcapi.ScheduledAction(action))
+	}
+	for _, policy := range config.TargetTrackingPolicies {
+		pc.TargetTrackingPolicies = append(pc.TargetTrackingPolicies, fcapi.TargetTrackingPolicy(policy))
+	}
+	return pc
+}
+
+func CreateProvisionConfig(ctx *Context, serviceName string, qualifier string, functionName string, config *provision.Config) error {
+	listProvisionConfigsInput := fc.NewListProvisionConfigsInput()
+	listProvisionConfigsOutput, err := fcapi.ListAllProvisionConfigs(ctx.fcClient, listProvisionConfigsInput)
+	if err != nil {
+		return err
+	}
+	resourcePattern := fmt.Sprintf("^.*#%s#(.+)#%s$", regexp.QuoteMeta(serviceName), regexp.QuoteMeta(functionName))
+	resourceRegex := regexp.MustCompile(resourcePattern)
+	var qualifiers []string
+
+	for _, pc := range listProvisionConfigsOutput.ProvisionConfigs {
+		if pc.Resource == nil {
+			continue
+		}
+		matches := resourceRegex.FindStringSubmatch(*pc.Resource)
+		if len(matches) < 2 || matches[1] == qualifier {
+			continue
+		}
+		if pc.Current != nil && pc.Target != nil && *pc.Current == 0 && *pc.Target == 0 {
+			// scheduled actions and target tracking policies are not listed,
+			// they may scale the old qualifier up again later
+			current, err1 := ctx.apiClient.GetProvisionConfig(serviceName, matches[1], functionName)
+			if err1 != nil {
+				return err1
+			}
+			if len(current.ScheduledActions) == 0 && len(current.TargetTrackingPolicies) == 0 {
+				continue
+			}
+		}
+		qualifiers = append(qualifiers, matches[1])
+	}
+
+	desired := newProvisionConfig(config)
+	lg := logging.With("step", "provision", "service", serviceName, "function", functionName, "qualifier", qualifier)
+	lg.Info("Provision", "target", desired.Target, "scheduled_actions", len(desired.ScheduledActions), "target_tracking_policies", len(desired.TargetTrackingPolicies))
+	for _, action := range desired.ScheduledActions {
+		lg.Debug("Scheduled action", "name", action.Name, "schedule", action.ScheduleExpression, "target", action.Target)
+	}
+	for _, policy := range desired.TargetTrackingPolicies {
+		lg.Debug("Target tracking policy", "name", policy.Name, "metric_type", policy.MetricType, "metric_target", policy.MetricTarget, "min", policy.MinCapacity, "max", policy.MaxCapacity)
+	}
+	for _, s := range qualifiers {
+		lg.Info("Remove provision of old qualifier", "old_qualifier", s)
+	}
+	if ctx.dryRun {
+		ctx.report.AddProvision(reportProvision(serviceName, functionName, qualifier, desired, nil))
+		for _, s := range qualifiers {
+			ctx.report.AddProvision(reportProvision(serviceName, functionName, s, &fcapi.ProvisionConfig{}, nil))
+		}
+		return nil
+	}
+	err = ctx.apiClient.PutProvisionConfig(serviceName, qualifier, functionName, desired)
+	ctx.report.AddProvision(reportProvision(serviceName, functionName, qualifier, desired, err))
+	if err != nil {
+		return err
+	}
+	// TODO: 同时创建相应ROS资源
+	if ctx.provisionHandover && len(qualifiers) > 0 {
+		if err = WaitProvisionReady(ctx, serviceName, qualifier, functionName, desired.Target); err != nil {
+			return fmt.Errorf("%w, provision of %s kept", err, strings.Join(qualifiers, ", "))
+		}
+	}
+	if err = ctx.checkLock(); err != nil {
+		return err
+	}
+	var failures []string
+	for _, qualifierToUpdate := range qualifiers {
+		err = ctx.apiClient.PutProvisionConfig(serviceName, qualifierToUpdate, functionName, &fcapi.ProvisionConfig{})
+		ctx.report.AddProvision(reportProvision(serviceName, functionName, qualifierToUpdate, &fcapi.ProvisionConfig{}, err))
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", qualifierToUpdate, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("remove provision of %s/%s failed: %s", serviceName, functionName, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func reportProvision(serviceName string, functionName string, qualifier string, pc *fcapi.ProvisionConfig, err error) report.Provision {
+	p := report.Provision{
+		Service:                serviceName,
+		Function:               functionName,
+		Qualifier:              qualifier,
+		Target:                 pc.Target,
+		ScheduledActions:       len(pc.ScheduledActions),
+		TargetTrackingPolicies: len(pc.TargetTrackingPolicies),
+	}
+	if err != nil {
+		p.Error = err.Error()
+	}
+	return p
+}
+
+// WaitProvisionReady polls provision config of qualifier until its current instances
+// reach target, or ctx.provisionTimeout elapsed.
+func WaitProvisionReady(ctx *Context, serviceName string, qualifier string, functionName string, target int64) error {
+	lg := logging.With("step", "provision", "service", serviceName, "function", functionName, "qualifier", qualifier)
+	deadline := time.Now().Add(ctx.provisionTimeout)
+	for {
+		pc, err := ctx.apiClient.GetProvisionConfig(serviceName, qualifier, functionName)
+		if err != nil {
+			return err
+		}
+		if err = ctx.checkLock(); err != nil {
+			return err
+		}
+		if pc.Current >= target {
+			lg.Info("Provision ready", "current", pc.Current, "target", target)
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("provision of %s/%s.%s not ready in %s: %d/%d", serviceName, functionName, qualifier, ctx.provisionTimeout, pc.Current, target)
+		}
+		lg.Info("Waiting provision", "current", pc.Current, "target", target)
+		time.Sleep(provisionPollInterval)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wsw0108/aliyun-fc-releaser/internal/hook"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/logging"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/notify"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/provision"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/report"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/serverless"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/version"
+)
+
+// Plan is a resolved release of template, service names are resolved by ROS.
+type Plan struct {
+	Version       version.Version
+	Commit        string
+	AliasName     string
+	Services      []serverless.Service
+	CustomDomains []serverless.CustomDomain
+	// ServiceNames maps service names in template to resolved ones
+	ServiceNames map[string]string
+	Spec         *ReleaseSpec
+	SkipSmoke    bool
+	StartTime    time.Time
+}
+
+// PreparePlan resolves services and custom domains of template into plan.
+func PreparePlan(ctx *Context, plan *Plan, template *serverless.Template, templateDir string, provisionSpec *provision.Spec, defaultInstances int64) error {
+	plan.ServiceNames = make(map[string]string)
+	for _, service := range template.Services {
+		functions := make([]serverless.Function, 0, len(service.Functions))
+		for _, function := range service.Functions {
+			var err error
+			function.ProvisionConfig, err = ResolveProvisionConfig(provisionSpec, service.Name, function.Name, function.ProvisionConfig, defaultInstances)
+			if err != nil {
+				return err
+			}
+			functions = append(functions, function)
+		}
+		service.Functions = functions
+		serviceName, err := ctx.GetServiceName(service.Name)
+		if err != nil {
+			return err
+		}
+		plan.ServiceNames[service.Name] = serviceName
+		templateName := service.Name
+		ctx.report.UpdateService(serviceName, func(s *report.Service) {
+			s.TemplateName = templateName
+		})
+		service.Name = serviceName
+		plan.Services = append(plan.Services, service)
+	}
+
+	existingDomains, err := ctx.apiClient.ListCustomDomains()
+	if err != nil {
+		return err
+	}
+	for _, customDomain := range template.CustomDomains {
+		cdc := customDomain
+		cdc.RouteConfig.Routes = make([]serverless.PathConfig, 0, len(customDomain.RouteConfig.Routes))
+		for _, route := range customDomain.RouteConfig.Routes {
+			serviceName, err := ctx.GetServiceName(route.ServiceName)
+			if err != nil {
+				return err
+			}
+			route.ServiceName = serviceName
+			cdc.RouteConfig.Routes = append(cdc.RouteConfig.Routes, route)
+		}
+		domainName := customDomain.DomainName
+		if domainName == "Auto" {
+			for _, tplRoute := range cdc.RouteConfig.Routes {
+				serviceName := tplRoute.ServiceName
+				functionName := tplRoute.FunctionName
+				for _, cdr := range existingDomains {
+					if strings.HasSuffix(cdr.DomainName, ".test.functioncompute.com") && cdr.RouteConfig != nil {
+						for _, route := range cdr.RouteConfig.Routes {
+							if route.ServiceName == serviceName && route.FunctionName == functionName {
+								domainName = cdr.DomainName
+							}
+						}
+					}
+				}
+			}
+		}
+		if domainName == "Auto" {
+			return fmt.Errorf("can not handle 'DomainName: Auto' of custom domain in region %s", ctx.regionID)
+		}
+		cdc.DomainName = domainName
+		if err = LoadCertConfig(ctx, &cdc, templateDir); err != nil {
+			return err
+		}
+		plan.CustomDomains = append(plan.CustomDomains, cdc)
+	}
+	return nil
+}
+
+// Release publishes services of plan, switches routes to the new alias and moves provisioned
+// instances, the result is finished by FinishRelease.
+func Release(ctx *Context, plan *Plan) error {
+	err := runRelease(ctx, plan)
+	FinishRelease(ctx, plan, err)
+	return err
+}
+
+// FinishRelease records result of release in report, runs OnFailure hooks if it failed and notifies
+// notifiers in any case. It is also called for failures before release, e.g. preparing plan.
+func FinishRelease(ctx *Context, plan *Plan, err error) {
+	if err != nil {
+		_ = RunHooks(ctx, plan, hook.OnFailure, err)
+	}
+	ctx.report.Finish(err)
+	Notify(ctx, plan, err)
+}
+
+// Notify posts summary of release to notifiers, failures are only logged.
+func Notify(ctx *Context, plan *Plan, cause error) {
+	if len(ctx.notifiers) == 0 {
+		return
+	}
+	s := notify.Summary{
+		Version:  plan.Version.Raw,
+		Alias:    plan.AliasName,
+		Region:   ctx.regionID,
+		Duration: time.Since(plan.StartTime),
+	}
+	for _, d := range ctx.report.CustomDomains {
+		for _, change := range d.Changes {
+			s.RouteChanges = append(s.RouteChanges, d.DomainName+": "+change)
+		}
+	}
+	for _, p := range ctx.report.Provisions {
+		s.ProvisionChanges = append(s.ProvisionChanges, fmt.Sprintf("%s/%s.%s: target %d", p.Service, p.Function, p.Qualifier, p.Target))
+	}
+	for _, service := range plan.Services {
+		s.Services = append(s.Services, service.Name)
+	}
+	if cause != nil {
+		s.Error = cause.Error()
+	}
+	if ctx.dryRun {
+		logging.Info("Notify (dry run)", "step", "notify", "notifiers", len(ctx.notifiers))
+		logging.Debug(s.Text(), "step", "notify")
+		return
+	}
+	for _, notifier := range ctx.notifiers {
+		if err := notifier.Notify(s); err != nil {
+			logging.Error("Notify failed", "step", "notify", "error", err)
+		}
+	}
+}
+
+func runRelease(ctx *Context, plan *Plan) error {
+	services := plan.Services
+	aliasName := plan.AliasName
+	unlock, err := LockServices(ctx, plan)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	for _, service := range services {
+		if err := CheckDowngrade(ctx, service.Name, plan.Version); err != nil {
+			return err
+		}
+	}
+	if err := RunHooks(ctx, plan, hook.BeforePublish, nil); err != nil {
+		return err
+	}
+	for _, service := range services {
+		if err := ctx.checkLock(); err != nil {
+			return err
+		}
+		logging.Info("Publish version and alias", "step", "publish", "service", service.Name)
+		if _, err := PublishAndCreateAlias(ctx, service.Name, plan.Version.Raw, aliasName); err != nil {
+			return err
+		}
+		for _, function := range service.Functions {
+			logging.Debug("Create HTTP triggers", "step", "trigger", "service", service.Name, "function", function.Name)
+			for _, trigger := range function.Triggers {
+				if trigger.Type != "HTTP" {
+					continue
+				}
+				if err := ctx.checkLock(); err != nil {
+					return err
+				}
+				if err := CreateHttpTrigger(ctx, service.Name, function.Name, trigger, aliasName); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := RunHooks(ctx, plan, hook.AfterAlias, nil); err != nil {
+		return err
+	}
+	if err := RunGates(ctx, plan.Spec, plan.ServiceNames, aliasName); err != nil {
+		logging.Error("Routes are not switched", "step", "gate", "qualifier", aliasName)
+		return err
+	}
+	if !plan.SkipSmoke {
+		if err := SmokeTest(ctx, services, plan.CustomDomains, aliasName); err != nil {
+			logging.Error("Routes are not switched", "step", "smoke", "qualifier", aliasName)
+			return err
+		}
+	}
+	if err := RunHooks(ctx, plan, hook.BeforeRouteSwitch, nil); err != nil {
+		logging.Error("Routes are not switched", "step", "hook", "qualifier", aliasName)
+		return err
+	}
+	for _, customDomain := range plan.CustomDomains {
+		if err := ctx.checkLock(); err != nil {
+			return err
+		}
+		if err := UpdateCustomDomain(ctx, customDomain, aliasName); err != nil {
+			return err
+		}
+	}
+	if err := ctx.checkLock(); err != nil {
+		return err
+	}
+	if err := PruneSnapshots(ctx, services, plan.CustomDomains, aliasName); err != nil {
+		return err
+	}
+	if !ctx.snapshot {
+		failed := false
+		for _, service := range services {
+			for _, function := range service.Functions {
+				if function.ProvisionConfig == nil {
+					continue
+				}
+				if err := ctx.checkLock(); err != nil {
+					return err
+				}
+				if err := CreateProvisionConfig(ctx, service.Name, aliasName, function.Name, function.ProvisionConfig); err != nil {
+					logging.Error("Provision failed", "step", "provision", "service", service.Name, "function", function.Name, "error", err)
+					failed = true
+				}
+			}
+		}
+		if failed {
+			return fmt.Errorf("provision failed")
+		}
+	}
+	// failure of hooks after release does not fail the release
+	_ = RunHooks(ctx, plan, hook.AfterRelease, nil)
+	return nil
+}
+
+// RunHooks runs hooks of phase in spec, it stops at the first failed hook. Hooks are
+// not run in dry run mode.
+func RunHooks(ctx *Context, plan *Plan, phase hook.Phase, cause error) error {
+	if plan.Spec == nil || len(plan.Spec.Hooks[phase]) == 0 {
+		return nil
+	}
+	m := hook.Metadata{
+		Phase:     phase,
+		Version:   plan.Version.Raw,
+		Alias:     plan.AliasName,
+		Commit:    plan.Commit,
+		Region:    ctx.regionID,
+		Snapshot:  ctx.snapshot,
+		DryRun:    ctx.dryRun,
+		StartTime: plan.StartTime,
+	}
+	for _, service := range plan.Services {
+		m.Services = append(m.Services, service.Name)
+	}
+	if cause != nil {
+		m.Error = cause.Error()
+	}
+	for _, h := range plan.Spec.Hooks[phase] {
+		if ctx.dryRun {
+			logging.Info("Run hook (dry run)", "step", "hook", "phase", phase, "hook", h)
+			continue
+		}
+		logging.Info("Run hook", "step", "hook", "phase", phase, "hook", h)
+		if err := h.Run(m); err != nil {
+			logging.Error("Hook failed", "step", "hook", "phase", phase, "hook", h, "error", err)
+			return fmt.Errorf("%s hook %s: %w", phase, h, err)
+		}
+	}
+	return nil
+}
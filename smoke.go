@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wsw0108/aliyun-fc-releaser/internal/logging"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/serverless"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/smoke"
+)
+
+func triggerURL(endpoint string, serviceName string, qualifier string, functionName string) string {
+	return fmt.Sprintf("%s/2016-08-15/proxy/%s.%s/%s/", strings.TrimSuffix(endpoint, "/"), serviceName, qualifier, functionName)
+}
+
+// SmokeTest runs smoke tests of functions and custom domain routes against HTTP trigger
+// of qualifier, it should be called before routes are switched to qualifier.
+func SmokeTest(ctx *Context, services []serverless.Service, customDomains []serverless.CustomDomain, qualifier string) error {
+	checks := make(map[string][]smoke.Check)
+	functions := make(map[string]serverless.Function)
+	for _, service := range services {
+		for _, function := range service.Functions {
+			key := service.Name + "/" + function.Name
+			functions[key] = function
+			checks[key] = append(checks[key], function.SmokeTests...)
+		}
+	}
+	for _, customDomain := range customDomains {
+		for _, route := range customDomain.RouteConfig.Routes {
+			key := route.ServiceName + "/" + route.FunctionName
+			checks[key] = append(checks[key], route.SmokeTests...)
+		}
+	}
+
+	var failures []string
+	for key, functionChecks := range checks {
+		if len(functionChecks) == 0 {
+			continue
+		}
+		function, ok := functions[key]
+		if !ok {
+			failures = append(failures, fmt.Sprintf("%s: function not in template", key))
+			continue
+		}
+		var trigger *serverless.Trigger
+		for i := range function.Triggers {
+			if function.Triggers[i].Type == "HTTP" {
+				trigger = &function.Triggers[i]
+				break
+			}
+		}
+		if trigger == nil {
+			failures = append(failures, fmt.Sprintf("%s: no HTTP trigger", key))
+			continue
+		}
+		if !strings.EqualFold(trigger.HTTP.AuthType, "anonymous") {
+			// NOTE: requests are not signed, checks configured for the function must not be skipped silently
+			failures = append(failures, fmt.Sprintf("%s: HTTP trigger is %s, not anonymous, use -skip-smoke to release without smoke tests", key, trigger.HTTP.AuthType))
+			continue
+		}
+		serviceName, functionName, _ := strings.Cut(key, "/")
+		lg := logging.With("step", "smoke", "service", serviceName, "function", functionName, "qualifier", qualifier)
+		baseURL := triggerURL(ctx.smokeEndpoint, serviceName, qualifier, functionName)
+		for _, check := range functionChecks {
+			if ctx.dryRun {
+				lg.Info("Smoke test (dry run)", "check", check, "url", baseURL)
+				continue
+			}
+			if err := ctx.smokeRunner.Run(baseURL, check); err != nil {
+				lg.Error("Smoke test failed", "check", check, "error", err)
+				failures = append(failures, fmt.Sprintf("%s %s: %v", key, check, err))
+				continue
+			}
+			lg.Info("Smoke test passed", "check", check)
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("smoke tests of %s failed: %s", qualifier, strings.Join(failures, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aliyun/fc-go-sdk"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/alias"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/fcapi"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/logging"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/release"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/report"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/serverless"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/types"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/version"
+)
+
+type Snapshot struct {
+	AliasName string
+	VersionID string
+	Time      time.Time
+}
+
+// ListSnapshots returns aliases of snapshot releases of service, the release time is
+// read from alias description, or creation time of the version for old aliases.
+func ListSnapshots(ctx *Context, serviceName string) ([]Snapshot, error) {
+	listAliasesOutput, err := fcapi.ListAllAliases(ctx.fcClient, fc.NewListAliasesInput(serviceName))
+	if err != nil {
+		return nil, err
+	}
+	var versionTimes map[string]time.Time
+	var snapshots []Snapshot
+	for _, am := range listAliasesOutput.Aliases {
+		if am.AliasName == nil || am.VersionID == nil || am.Description == nil {
+			continue
+		}
+		desc := release.ParseDescription(*am.Description)
+		if !desc.IsSnapshot() {
+			continue
+		}
+		snapshot := Snapshot{
+			AliasName: *am.AliasName,
+			VersionID: *am.VersionID,
+			Time:      desc.Time,
+		}
+		if snapshot.Time.IsZero() {
+			if versionTimes == nil {
+				versionTimes, err = listVersionTimes(ctx, serviceName)
+				if err != nil {
+					return nil, err
+				}
+			}
+			snapshot.Time = versionTimes[snapshot.VersionID]
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+func listVersionTimes(ctx *Context, serviceName string) (map[string]time.Time, error) {
+	resp, err := fcapi.ListAllServiceVersions(ctx.fcClient, fc.NewListServiceVersionsInput(serviceName))
+	if err != nil {
+		return nil, err
+	}
+	times := make(map[string]time.Time)
+	for _, vm := range resp.Versions {
+		if vm.VersionID == nil || vm.CreatedTime == nil {
+			continue
+		}
+		createTime, _ := time.Parse(types.TimeLayout, *vm.CreatedTime)
+		times[*vm.VersionID] = createTime
+	}
+	return times, nil
+}
+
+// PruneSnapshots removes routes, triggers and aliases of snapshot releases older than ctx.snapshotTTL,
+// the alias being released is always kept.
+func PruneSnapshots(ctx *Context, services []serverless.Service, customDomains []serverless.CustomDomain, currentAlias string) error {
+	if ctx.snapshotTTL <= 0 {
+		return nil
+	}
+	expireTime := time.Now().Add(-ctx.snapshotTTL)
+	expired := make(map[string]map[string]bool)
+	for _, service := range services {
+		snapshots, err := ListSnapshots(ctx, service.Name)
+		if err != nil {
+			return err
+		}
+		for _, snapshot := range snapshots {
+			if snapshot.AliasName == currentAlias || snapshot.Time.IsZero() || snapshot.Time.After(expireTime) {
+				continue
+			}
+			if expired[service.Name] == nil {
+				expired[service.Name] = make(map[string]bool)
+			}
+			expired[service.Name][snapshot.AliasName] = true
+		}
+	}
+	if len(expired) == 0 {
+		logging.Info("No expired snapshot aliases", "step", "prune", "ttl", ctx.snapshotTTL)
+		return nil
+	}
+	for serviceName, aliases := range expired {
+		for aliasName := range aliases {
+			logging.Info("Expired snapshot alias", "step", "prune", "service", serviceName, "qualifier", aliasName, "ttl", ctx.snapshotTTL)
+		}
+	}
+
+	for _, customDomain := range customDomains {
+		if err := pruneSnapshotRoutes(ctx, customDomain.DomainName, expired); err != nil {
+			return err
+		}
+	}
+	for _, service := range services {
+		aliases := expired[service.Name]
+		if len(aliases) == 0 {
+			continue
+		}
+		for _, function := range service.Functions {
+			if err := pruneSnapshotTriggers(ctx, service.Name, function.Name, aliases); err != nil {
+				return err
+			}
+		}
+		for aliasName := range aliases {
+			logging.Info("Delete alias", "step", "prune", "service", service.Name, "qualifier", aliasName)
+			deleted := aliasName
+			ctx.report.UpdateService(service.Name, func(s *report.Service) {
+				s.DeletedAliases = append(s.DeletedAliases, deleted)
+			})
+			if ctx.dryRun {
+				continue
+			}
+			if _, err := ctx.fcClient.DeleteAlias(fc.NewDeleteAliasInput(service.Name, aliasName)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pruneSnapshotRoutes removes "/<alias>/..." routes of expired aliases from custom domain. Unprefixed
+// main routes are never removed, aliases they still point to are removed from expired so that
+// they are kept, e.g. snapshots released when no stable alias existed.
+func pruneSnapshotRoutes(ctx *Context, domainName string, expired map[string]map[string]bool) error {
+	current, err := ctx.apiClient.GetCustomDomain(domainName)
+	if err != nil {
+		if fcapi.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if current.RouteConfig == nil {
+		return nil
+	}
+	routeConfig := &fcapi.RouteConfig{}
+	var removed []fcapi.PathConfig
+	for _, route := range current.RouteConfig.Routes {
+		if expired[route.ServiceName][route.Qualifier] {
+			if isSnapshotRoute(route) {
+				removed = append(removed, route)
+				continue
+			}
+			logging.Warn("Expired snapshot alias kept, main route points to it", "step", "prune", "domain", domainName, "path", route.Path, "service", route.ServiceName, "qualifier", route.Qualifier)
+			delete(expired[route.ServiceName], route.Qualifier)
+		}
+		routeConfig.Routes = append(routeConfig.Routes, route)
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	logRoutes(logging.With("step", "prune", "domain", domainName), logging.LevelInfo, "Route to remove", removed)
+	ctx.report.UpdateCustomDomain(domainName, func(d *report.CustomDomain) {
+		for _, route := range removed {
+			d.Changes = append(d.Changes, fmt.Sprintf("- %s -> %s/%s[%s] (expired)", route.Path, route.ServiceName, route.FunctionName, route.Qualifier))
+		}
+	})
+	if ctx.dryRun {
+		return nil
+	}
+	return ctx.apiClient.UpdateCustomDomain(&fcapi.CustomDomain{
+		DomainName:  domainName,
+		Protocol:    current.Protocol,
+		RouteConfig: routeConfig,
+	})
+}
+
+func pruneSnapshotTriggers(ctx *Context, serviceName string, functionName string, aliases map[string]bool) error {
+	listTriggerOutput, err := fcapi.ListAllTriggers(ctx.fcClient, fc.NewListTriggersInput(serviceName, functionName))
+	if err != nil {
+		return err
+	}
+	for _, tm := range listTriggerOutput.Triggers {
+		if tm.Qualifier == nil || !aliases[*tm.Qualifier] {
+			continue
+		}
+		logging.Info("Delete trigger", "step", "prune", "service", serviceName, "function", functionName, "qualifier", *tm.Qualifier, "trigger", *tm.TriggerName)
+		deleted := report.Trigger{Function: functionName, Name: *tm.TriggerName, Qualifier: *tm.Qualifier}
+		ctx.report.UpdateService(serviceName, func(s *report.Service) {
+			s.DeletedTriggers = append(s.DeletedTriggers, deleted)
+		})
+		if ctx.dryRun {
+			continue
+		}
+		if _, err = ctx.fcClient.DeleteTrigger(fc.NewDeleteTriggerInput(serviceName, functionName, *tm.TriggerName)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isSnapshotRoute reports whether route is a "/<alias>/..." route added by a snapshot release.
+func isSnapshotRoute(route fcapi.PathConfig) bool {
+	return route.Qualifier != "" && strings.HasPrefix(route.Path, "/"+route.Qualifier+"/")
+}
+
+// PruneSnapshotPrefixes keeps routes of the newest ctx.maxSnapshotPrefixes snapshot prefixes,
+// routes of older prefixes are returned as removed.
+func PruneSnapshotPrefixes(ctx *Context, routes []fcapi.PathConfig, currentQualifier string) ([]fcapi.PathConfig, []fcapi.PathConfig, error) {
+	if ctx.maxSnapshotPrefixes <= 0 {
+		return routes, nil, nil
+	}
+	prefixTimes := make(map[string]time.Time)
+	snapshotTimes := make(map[string]map[string]time.Time)
+	for _, route := range routes {
+		if !isSnapshotRoute(route) {
+			continue
+		}
+		if _, ok := snapshotTimes[route.ServiceName]; !ok {
+			snapshots, err := ListSnapshots(ctx, route.ServiceName)
+			if err != nil {
+				return nil, nil, err
+			}
+			times := make(map[string]time.Time)
+			for _, snapshot := range snapshots {
+				times[snapshot.AliasName] = snapshot.Time
+			}
+			snapshotTimes[route.ServiceName] = times
+		}
+		t, ok := snapshotTimes[route.ServiceName][route.Qualifier]
+		if !ok || t.IsZero() {
+			t, _ = alias.ParseDate(route.Qualifier)
+		}
+		if route.Qualifier == currentQualifier {
+			t = time.Now()
+		}
+		if prev, ok := prefixTimes[route.Qualifier]; !ok || t.After(prev) {
+			prefixTimes[route.Qualifier] = t
+		}
+	}
+	if len(prefixTimes) <= ctx.maxSnapshotPrefixes {
+		return routes, nil, nil
+	}
+	var prefixes []string
+	for prefix := range prefixTimes {
+		prefixes = append(prefixes, prefix)
+	}
+	// newest first
+	sort.Slice(prefixes, func(i, j int) bool {
+		ti, tj := prefixTimes[prefixes[i]], prefixTimes[prefixes[j]]
+		if ti.Equal(tj) {
+			return prefixes[i] > prefixes[j]
+		}
+		return ti.After(tj)
+	})
+	toRemove := make(map[string]bool)
+	for _, prefix := range prefixes[ctx.maxSnapshotPrefixes:] {
+		toRemove[prefix] = true
+	}
+	var kept, removed []fcapi.PathConfig
+	for _, route := range routes {
+		if isSnapshotRoute(route) && toRemove[route.Qualifier] {
+			removed = append(removed, route)
+		} else {
+			kept = append(kept, route)
+		}
+	}
+	return kept, removed, nil
+}
+
+// ResolveBaselineQualifier returns the stable alias unprefixed routes of a snapshot release should
+// point to: the stable alias of the same version if it exists, otherwise the newest stable alias.
+func ResolveBaselineQualifier(ctx *Context, serviceName string) (string, error) {
+	if baseline, ok := ctx.baselines[serviceName]; ok {
+		return baseline, nil
+	}
+	listAliasesOutput, err := fcapi.ListAllAliases(ctx.fcClient, fc.NewListAliasesInput(serviceName))
+	if err != nil {
+		return "", err
+	}
+	var baseline string
+	var newest *version.Version
+	for _, am := range listAliasesOutput.Aliases {
+		if am.AliasName == nil {
+			continue
+		}
+		if *am.AliasName == ctx.prevQualifier {
+			baseline = *am.AliasName
+			newest = nil
+			break
+		}
+		if am.Description == nil {
+			continue
+		}
+		desc := release.ParseDescription(*am.Description)
+		if desc.IsSnapshot() {
+			continue
+		}
+		ver, err := ctx.versionPolicy.Parse(desc.Version)
+		if err != nil {
+			continue
+		}
+		if newest == nil {
+			baseline, newest = *am.AliasName, &ver
+			continue
+		}
+		if c, ok := ver.Compare(*newest); ok && c > 0 {
+			baseline, newest = *am.AliasName, &ver
+		}
+	}
+	switch {
+	case baseline == "":
+		logging.Warn("No stable alias found", "step", "baseline", "service", serviceName)
+	case baseline == ctx.prevQualifier:
+		logging.Info("Baseline alias", "step", "baseline", "service", serviceName, "qualifier", baseline)
+	default:
+		logging.Warn("Alias not found, baseline falls back to newest stable alias", "step", "baseline", "service", serviceName, "missing", ctx.prevQualifier, "qualifier", baseline)
+	}
+	if ctx.baselines == nil {
+		ctx.baselines = make(map[string]string)
+	}
+	ctx.baselines[serviceName] = baseline
+	return baseline, nil
+}
+
+func snapshotMainQualifier(ctx *Context, route fcapi.PathConfig) (string, error) {
+	if route.Qualifier != "" && route.Qualifier != "LATEST" {
+		snapshots, err := ListSnapshots(ctx, route.ServiceName)
+		if err != nil {
+			return "", err
+		}
+		isSnapshot := false
+		for _, snapshot := range snapshots {
+			if snapshot.AliasName == route.Qualifier {
+				isSnapshot = true
+				break
+			}
+		}
+		if !isSnapshot {
+			return route.Qualifier, nil
+		}
+	}
+	baseline, err := ResolveBaselineQualifier(ctx, route.ServiceName)
+	if err != nil {
+		return "", err
+	}
+	if baseline == "" {
+		// keep the route as is
+		return route.Qualifier, nil
+	}
+	return baseline, nil
+}
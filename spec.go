@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wsw0108/aliyun-fc-releaser/internal/gate"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/hook"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/logging"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/types"
+	"gopkg.in/yaml.v3"
+)
+
+// ReleaseSpec is release steps besides the template, keyed by service and function name
+// in template:
+//
+//	Gates:
+//	  my-service:
+//	    my-function:
+//	      - PayloadFile: testdata/event.json
+//	        ExpectJSON:
+//	          code: 0
+//	        MaxDuration: 3s
+//	Hooks:
+//	  BeforeRouteSwitch:
+//	    - Command: ./migrate.sh
+//	  AfterRelease:
+//	    - URL: https://example.com/webhook
+type ReleaseSpec struct {
+	Gates map[string]map[string][]gate.Gate `yaml:"Gates"`
+	Hooks map[hook.Phase][]hook.Hook        `yaml:"Hooks"`
+
+	baseDir string
+}
+
+func loadReleaseSpec(filename string) (*ReleaseSpec, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var decoded ReleaseSpec
+	err = yaml.NewDecoder(f).Decode(&decoded)
+	if err != nil {
+		return nil, err
+	}
+	for phase := range decoded.Hooks {
+		if !validPhase(phase) {
+			return nil, fmt.Errorf("unknown hook phase %s", phase)
+		}
+	}
+	decoded.baseDir = filepath.Dir(filename)
+	return &decoded, nil
+}
+
+func validPhase(phase hook.Phase) bool {
+	for _, p := range hook.Phases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns error if gates of spec reference service or function not in functions.
+func (s *ReleaseSpec) Check(functions types.Functions) error {
+	if s == nil {
+		return nil
+	}
+	refs := make(map[string][]string)
+	for serviceName, fns := range s.Gates {
+		refs[serviceName] = nil
+		for functionName := range fns {
+			refs[serviceName] = append(refs[serviceName], functionName)
+		}
+	}
+	return functions.CheckRefs("release spec", refs)
+}
+
+// RunGates invokes qualifier of functions with gates in spec, gates are keyed by
+// service name in template, names maps them to resolved service names.
+func RunGates(ctx *Context, spec *ReleaseSpec, names map[string]string, qualifier string) error {
+	if spec == nil {
+		return nil
+	}
+	var failures []string
+	for serviceName, functions := range spec.Gates {
+		for functionName, gates := range functions {
+			resolved := names[serviceName]
+			lg := logging.With("step", "gate", "service", resolved, "function", functionName, "qualifier", qualifier)
+			for _, g := range gates {
+				if ctx.dryRun {
+					lg.Info("Gate (dry run)", "gate", g)
+					continue
+				}
+				if err := gate.Run(ctx.fcClient, resolved, qualifier, functionName, g, spec.baseDir); err != nil {
+					lg.Error("Gate failed", "gate", g, "error", err)
+					failures = append(failures, fmt.Sprintf("%s/%s %s: %v", resolved, functionName, g, err))
+					continue
+				}
+				lg.Info("Gate passed", "gate", g)
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("gates of %s failed: %s", qualifier, strings.Join(failures, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/wsw0108/aliyun-fc-releaser/internal/gitrepo"
+)
+
+// Runs git to build a repository in a temporary directory, and checks that it is
+// read the same way by gitrepo: loose, packed and annotated tags, index v2 and v4,
+// changes in working tree and staged changes, and objects packed as deltas.
+func main() {
+	dir, err := os.MkdirTemp("", "gitrepo")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer os.RemoveAll(dir)
+
+	git(dir, "init", "-q")
+	write(dir, "a.txt", strings.Repeat("line of a\n", 100))
+	write(dir, "sub/b.txt", "b\n")
+	write(dir, "run.sh", "#!/bin/sh\n")
+	// many files so that trees are large enough to be deltified
+	for i := 0; i < 50; i++ {
+		write(dir, fmt.Sprintf("sub/file-%02d.txt", i), fmt.Sprintln(i))
+	}
+	git(dir, "add", ".")
+	git(dir, "commit", "-q", "-m", "first")
+	git(dir, "tag", "v1.0.0")
+	expectTag(dir, "loose lightweight tag", "v1.0.0")
+	expectDirty(dir, "clean, index v2")
+
+	write(dir, "a.txt", strings.Repeat("line of a\n", 100)+"more\n")
+	expectDirty(dir, "modified in working tree", "a.txt")
+	git(dir, "add", "a.txt")
+	expectDirty(dir, "modified and staged", "a.txt")
+	git(dir, "commit", "-q", "-m", "second")
+	expectDirty(dir, "committed")
+
+	write(dir, "c.txt", "c\n")
+	expectDirty(dir, "untracked")
+	git(dir, "add", "c.txt")
+	expectDirty(dir, "added and staged", "c.txt")
+	git(dir, "rm", "-q", "--cached", "c.txt")
+	os.Remove(filepath.Join(dir, "c.txt"))
+	git(dir, "rm", "-q", "--cached", "sub/b.txt")
+	expectDirty(dir, "removed from index", "sub/b.txt")
+	git(dir, "reset", "-q")
+	expectDirty(dir, "reset")
+	git(dir, "update-index", "--chmod=-x", "run.sh")
+	expectDirty(dir, "mode staged", "run.sh")
+	git(dir, "update-index", "--chmod=+x", "run.sh")
+
+	git(dir, "tag", "v1.0.1")
+	git(dir, "tag", "-a", "-m", "release", "v1.1.0")
+	expectTag(dir, "loose annotated tag", "v1.1.0")
+	git(dir, "pack-refs", "--all")
+	expectTag(dir, "packed annotated tag", "v1.1.0")
+
+	for i := 0; i < 5; i++ {
+		write(dir, "a.txt", strings.Repeat("line of a\n", 100+i))
+		write(dir, "sub/b.txt", strings.Repeat("b\n", i))
+		git(dir, "commit", "-q", "-a", "-m", "more")
+	}
+	git(dir, "tag", "-a", "-m", "release", "v1.2.0")
+	git(dir, "gc", "-q", "--aggressive")
+	expectTag(dir, "packed tag object after gc", "v1.2.0")
+	expectDirty(dir, "packed objects")
+	git(dir, "tag", "-a", "-m", "release", "v1.3.0")
+	git(dir, "repack", "-q", "-a", "-d", "-f", "--depth=50")
+	expectTag(dir, "loose ref of packed tag object", "v1.3.0")
+	expectDirty(dir, "repacked objects")
+	packs, _ := filepath.Glob(filepath.Join(dir, ".git", "objects", "pack", "*.idx"))
+	var deltas, treeDeltas int
+	for _, line := range strings.Split(git(dir, append([]string{"verify-pack", "-v"}, packs...)...), "\n") {
+		// deltified entries: "<sha> <type> <size> <size in pack> <offset> <depth> <base sha>"
+		if fields := strings.Fields(line); len(fields) == 7 && len(fields[0]) == 40 {
+			deltas++
+			if fields[1] == "tree" {
+				treeDeltas++
+			}
+		}
+	}
+	if treeDeltas == 0 {
+		log.Fatalln("expect deltified trees in pack")
+	}
+	log.Printf("deltified objects: %d, trees: %d", deltas, treeDeltas)
+
+	git(dir, "update-index", "--index-version", "4")
+	expectDirty(dir, "clean, index v4")
+	write(dir, "sub/b.txt", "changed\n")
+	expectDirty(dir, "modified, index v4", "sub/b.txt")
+	git(dir, "add", "sub/b.txt")
+	expectDirty(dir, "staged, index v4", "sub/b.txt")
+}
+
+func git(dir string, args ...string) string {
+	args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "tag.gpgSign=false", "-c", "commit.gpgSign=false"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func write(dir string, name string, content string) {
+	filename := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		log.Fatalln(err)
+	}
+	mode := os.FileMode(0644)
+	if strings.HasSuffix(name, ".sh") {
+		mode = 0755
+	}
+	if err := os.WriteFile(filename, []byte(content), mode); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func open(dir string) *gitrepo.Repo {
+	repo, err := gitrepo.Open(dir)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return repo
+}
+
+func expectTag(dir string, name string, want string) {
+	repo := open(dir)
+	head, err := repo.Head()
+	if err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	if want := strings.TrimSpace(git(dir, "rev-parse", "HEAD")); head != want {
+		log.Fatalf("%s: expect HEAD %s, got %s", name, want, head)
+	}
+	tag, err := repo.VersionTag()
+	if err != nil || tag != want {
+		log.Fatalf("%s: expect tag %s, got %s %v", name, want, tag, err)
+	}
+	log.Printf("%s: %s", name, tag)
+}
+
+func expectDirty(dir string, name string, want ...string) {
+	dirty, err := open(dir).Dirty()
+	if err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	if len(dirty) == 0 && len(want) == 0 || reflect.DeepEqual(dirty, want) {
+		log.Printf("%s: dirty %v", name, dirty)
+		return
+	}
+	log.Fatalf("%s: expect dirty %v, got %v", name, want, dirty)
+}
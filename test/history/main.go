@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aliyun/fc-go-sdk"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/fakefc"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/history"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/release"
+)
+
+func main() {
+	server := fakefc.New()
+	defer server.Close()
+
+	now := time.Now().Truncate(time.Second)
+	descriptions := []release.Description{
+		{Version: "1.0.0", Commit: "0123456789abcdef", Time: now.Add(-2 * time.Hour), Operator: "alice"},
+		{Version: "1.1.0-rc.1", Time: now.Add(-time.Hour), Snapshot: true, Operator: "bob smith", RunURL: "https://ci.example.com/jobs/42"},
+		{Version: "1.1.0", Time: now, Operator: "bob smith", Changelog: "fix 100% of bugs\n" + strings.Repeat("一", 200)},
+	}
+	// version published by hand before descriptions were recorded
+	server.AddVersion("svc", fakefc.Object{"versionId": "1", "description": "0.9.0", "createdTime": now.Add(-3 * time.Hour).UTC().Format("2006-01-02T15:04:05Z")})
+	for i, d := range descriptions {
+		s := d.String()
+		if len(s) > release.MaxLength {
+			log.Fatalf("description of %s is too long: %d", d.Version, len(s))
+		}
+		id := string(rune('2' + i))
+		server.AddVersion("svc", fakefc.Object{"versionId": id, "description": s})
+		server.AddAlias("svc", fakefc.Object{"aliasName": "v" + strings.NewReplacer(".", "_", "-", "_").Replace(d.Version), "versionId": id, "description": s})
+	}
+	server.AddAlias("svc", fakefc.Object{"aliasName": "release-lock", "versionId": "4", "description": "lock owner=ci version=1.1.0"})
+
+	client, err := fc.NewClient(server.URL, "2016-08-15", "id", "secret")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	entries, err := history.Load(client, "svc")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(entries) != 4 {
+		log.Fatalf("expect 4 entries, got %d", len(entries))
+	}
+	latest := entries[0]
+	if latest.Version != "1.1.0" || latest.Operator != "bob smith" || len(latest.Aliases) != 1 || !strings.HasPrefix(latest.Changelog, "fix 100% of bugs\n一") {
+		log.Fatalf("unexpected latest entry: %+v", latest)
+	}
+	if entries[1].RunURL != "https://ci.example.com/jobs/42" || !entries[1].Snapshot {
+		log.Fatalf("unexpected snapshot entry: %+v", entries[1])
+	}
+	if oldest := entries[3]; oldest.Version != "0.9.0" || oldest.Time.IsZero() {
+		log.Fatalf("unexpected oldest entry: %+v", oldest)
+	}
+	if err = history.Write(os.Stdout, "", entries); err != nil {
+		log.Fatalln(err)
+	}
+	if err = history.Write(os.Stdout, "yaml", entries[:1]); err != nil {
+		log.Fatalln(err)
+	}
+}
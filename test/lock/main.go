@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aliyun/fc-go-sdk"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/fakefc"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/lock"
+)
+
+func main() {
+	server := fakefc.New()
+	defer server.Close()
+	server.AddVersion("svc", fakefc.Object{"versionId": "1", "description": "1.0.0"})
+	server.AddVersion("svc", fakefc.Object{"versionId": "2", "description": "1.0.1"})
+
+	client, err := fc.NewClient(server.URL, "2016-08-15", "id", "secret")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	a := lock.NewLocker(client, "ci-a", time.Hour)
+	b := lock.NewLocker(client, "ci-b", time.Hour)
+
+	mustLock(a, "1.0.2")
+	err = b.Lock("svc", "1.0.3")
+	var locked *lock.LockedError
+	if !errors.As(err, &locked) || locked.Info.Owner != "ci-a" || locked.Info.Version != "1.0.2" {
+		log.Fatalf("b locks: expect locked by ci-a, got %v", err)
+	}
+	log.Printf("b locks: %v", err)
+	if err = a.Renew("svc", "1.0.2"); err != nil {
+		log.Fatalln(err)
+	}
+	if err = b.Renew("svc", "1.0.3"); !errors.As(err, &locked) {
+		log.Fatalf("b renews: expect locked by ci-a, got %v", err)
+	}
+	if err = b.Unlock("svc"); err == nil {
+		log.Fatalln("b unlocks: expect error")
+	}
+	if err = a.Unlock("svc"); err != nil {
+		log.Fatalln(err)
+	}
+	mustLock(b, "1.0.3")
+
+	// expired lock of b is taken over by a
+	b.TTL = -time.Minute
+	mustLock(b, "1.0.3")
+	mustLock(a, "1.0.4")
+	info, _, ok, err := lock.Status(client, "svc")
+	if err != nil || !ok || info.Owner != "ci-a" {
+		log.Fatalf("status: expect locked by ci-a, got %v %v %v", info, ok, err)
+	}
+
+	info, ok, err = lock.ForceUnlock(client, "svc")
+	if err != nil || !ok || info.Owner != "ci-a" {
+		log.Fatalf("force-unlock: expect lock of ci-a removed, got %v %v %v", info, ok, err)
+	}
+	_, _, ok, err = lock.Status(client, "svc")
+	expect("locked after force-unlock", ok, false)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err = a.Renew("svc", "1.0.4"); !errors.Is(err, lock.ErrRemoved) {
+		log.Fatalf("a renews after force-unlock: expect ErrRemoved, got %v", err)
+	}
+	mustLock(a, "1.0.4")
+	if err = a.Lock("empty", "1.0.4"); !errors.Is(err, lock.ErrNoVersion) {
+		log.Fatalf("lock empty service: expect ErrNoVersion, got %v", err)
+	}
+}
+
+func mustLock(l *lock.Locker, version string) {
+	if err := l.Lock("svc", version); err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("%s locks %s", l.Owner, version)
+}
+
+func expect(name string, got bool, want bool) {
+	if got != want {
+		log.Fatalf("%s: expect %v, got %v", name, want, got)
+	}
+	log.Printf("%s: %v", name, got)
+}
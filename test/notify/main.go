@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/wsw0108/aliyun-fc-releaser/internal/notify"
+)
+
+func main() {
+	received := make(map[string]map[string]interface{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received[r.URL.Path] = body
+		switch r.URL.Path {
+		case "/dingtalk", "/wecom":
+			if r.URL.Path == "/dingtalk" && (r.URL.Query().Get("sign") == "" || r.URL.Query().Get("timestamp") == "") {
+				fmt.Fprint(w, `{"errcode":310000,"errmsg":"sign not match"}`)
+				return
+			}
+			fmt.Fprint(w, `{"errcode":0,"errmsg":"ok"}`)
+		case "/feishu":
+			if body["sign"] == nil {
+				fmt.Fprint(w, `{"code":19021,"msg":"sign match fail"}`)
+				return
+			}
+			fmt.Fprint(w, `{"code":0,"msg":"success"}`)
+		case "/slack":
+			fmt.Fprint(w, "ok")
+		case "/webhook":
+			w.WriteHeader(http.StatusNoContent)
+		case "/broken":
+			fmt.Fprint(w, `{"errcode":40001,"errmsg":"invalid token"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	summary := notify.Summary{
+		Version:          "1.2.3",
+		Alias:            "v1_2_3",
+		Services:         []string{"svc"},
+		RouteChanges:     []string{"example.com: ~ /api/* svc/fn qualifier v1_2_2 -> v1_2_3"},
+		ProvisionChanges: []string{"svc/fn.v1_2_3: target 2"},
+		Duration:         42 * time.Second,
+	}
+	cases := []struct {
+		config notify.Config
+		pass   bool
+	}{
+		{notify.Config{Type: notify.TypeDingTalk, URL: server.URL + "/dingtalk?access_token=t", Secret: "s"}, true},
+		{notify.Config{Type: notify.TypeFeishu, URL: server.URL + "/feishu", Secret: "s"}, true},
+		{notify.Config{Type: notify.TypeFeishu, URL: server.URL + "/feishu"}, false},
+		{notify.Config{Type: notify.TypeWeCom, URL: server.URL + "/wecom"}, true},
+		{notify.Config{Type: notify.TypeSlack, URL: server.URL + "/slack"}, true},
+		{notify.Config{Type: notify.TypeWebhook, URL: server.URL + "/webhook"}, true},
+		{notify.Config{Type: notify.TypeWeCom, URL: server.URL + "/broken"}, false},
+		{notify.Config{Type: notify.TypeSlack, URL: server.URL + "/missing"}, false},
+	}
+	for _, c := range cases {
+		n, err := notify.New(c.config)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		err = n.Notify(summary)
+		if (err == nil) != c.pass {
+			log.Fatalf("%s %s: expect pass=%v, got %v", c.config.Type, c.config.URL, c.pass, err)
+		}
+		fmt.Printf("%s: ok (%v)\n", c.config.Type, err)
+	}
+	if _, err := notify.New(notify.Config{Type: "unknown", URL: server.URL}); err == nil {
+		log.Fatalln("expect error of unknown notifier type")
+	}
+	if received["/webhook"]["alias"] != "v1_2_3" {
+		log.Fatalln("unexpected webhook body", received["/webhook"])
+	}
+	fmt.Print(summary.Text())
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aliyun/fc-go-sdk"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/fakefc"
+	"github.com/wsw0108/aliyun-fc-releaser/internal/fcapi"
+)
+
+// n items are served in pages of 2
+const n = 5
+
+func main() {
+	server := fakefc.New()
+	defer server.Close()
+
+	for i := 0; i < n; i++ {
+		id := fmt.Sprint(i + 1)
+		server.AddVersion("svc", fakefc.Object{"versionId": id, "description": "1.0." + id})
+		server.AddAlias("svc", fakefc.Object{"aliasName": "v1_0_" + id, "versionId": id, "description": "1.0." + id})
+		server.AddTrigger("svc", "fn", fakefc.Object{"triggerName": "http-" + id, "triggerType": "http", "qualifier": "v1_0_" + id})
+		server.AddProvisionConfig(fakefc.Object{"resource": "123#svc#v1_0_" + id + "#fn", "target": 1, "current": 1})
+		server.AddCustomDomain(fakefc.Object{"domainName": "d" + id + ".example.com", "protocol": "HTTP"})
+	}
+
+	client, err := fc.NewClient(server.URL, "2016-08-15", "id", "secret")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	versions, err := fcapi.ListAllServiceVersions(client, fc.NewListServiceVersionsInput("svc"))
+	check("versions", len(versions.Versions), err)
+	aliases, err := fcapi.ListAllAliases(client, fc.NewListAliasesInput("svc"))
+	check("aliases", len(aliases.Aliases), err)
+	triggers, err := fcapi.ListAllTriggers(client, fc.NewListTriggersInput("svc", "fn"))
+	check("triggers", len(triggers.Triggers), err)
+	provisionConfigs, err := fcapi.ListAllProvisionConfigs(client, fc.NewListProvisionConfigsInput())
+	check("provision configs", len(provisionConfigs.ProvisionConfigs), err)
+	domains, err := fcapi.NewClient(client).ListCustomDomains()
+	check("custom domains", len(domains), err)
+}
+
+func check(name string, got int, err error) {
+	if err != nil {
+		log.Fatalln(name, err)
+	}
+	if got != n {
+		log.Fatalf("%s: expect %d items, got %d", name, n, got)
+	}
+	log.Printf("%s: %d items", name, got)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/wsw0108/aliyun-fc-releaser/internal/smoke"
+)
+
+func main() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/svc.v1_0_0/fn/health":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"status":"ok","data":{"items":[{"id":1}]}}`)
+		case "/svc.v1_0_0/fn/echo":
+			if r.Method != http.MethodPost || r.Header.Get("X-Token") != "t" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, "echo")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	runner := smoke.NewRunner(time.Second)
+	baseURL := server.URL + "/svc.v1_0_0/fn/"
+	cases := []struct {
+		check smoke.Check
+		pass  bool
+	}{
+		{smoke.Check{Path: "/health", ExpectBody: `"ok"`, ExpectJSON: map[string]interface{}{"status": "ok", "data.items.0.id": 1}}, true},
+		{smoke.Check{Path: "/health", ExpectJSON: map[string]interface{}{"data.items.0.id": 2}}, false},
+		{smoke.Check{Path: "/health", ExpectJSON: map[string]interface{}{"data.missing": 2}}, false},
+		{smoke.Check{Path: "/echo", Method: "POST", Headers: map[string]string{"X-Token": "t"}, ExpectStatus: 201, ExpectBody: "^echo$"}, true},
+		{smoke.Check{Path: "/echo", Method: "POST", ExpectStatus: 201}, false},
+		{smoke.Check{Path: "/missing"}, false},
+	}
+	for _, c := range cases {
+		err := runner.Run(baseURL, c.check)
+		if (err == nil) != c.pass {
+			log.Fatalf("%s: expect pass=%v, got %v", c.check, c.pass, err)
+		}
+		fmt.Printf("%s: ok (%v)\n", c.check, err)
+	}
+}